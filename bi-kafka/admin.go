@@ -0,0 +1,314 @@
+package bikafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+var (
+	// ErrTopicNotFound is returned by ValidateTopics for the missing topics
+	ErrTopicNotFound = errors.New("topic not found")
+	// ErrTopicMismatch is returned by ValidateTopics for the topics which do not match
+	// their spec
+	ErrTopicMismatch = errors.New("topic does not match its spec")
+)
+
+// TopicSpec describes a topic. Zero Partitions and ReplicationFactor use the broker
+// defaults. Configs are the topic level configs, e.g. "retention.ms".
+type TopicSpec struct {
+	Name              string
+	Partitions        int
+	ReplicationFactor int
+	Configs           map[string]string
+}
+
+// TopicInfo is the metadata of a topic
+type TopicInfo struct {
+	Name              string
+	Partitions        int
+	ReplicationFactor int
+}
+
+// adminClient is the part of kafka.Client used by Admin
+type adminClient interface {
+	CreateTopics(ctx context.Context, req *kafka.CreateTopicsRequest) (*kafka.CreateTopicsResponse, error)
+	Metadata(ctx context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error)
+	DescribeConfigs(ctx context.Context, req *kafka.DescribeConfigsRequest) (*kafka.DescribeConfigsResponse, error)
+	IncrementalAlterConfigs(
+		ctx context.Context, req *kafka.IncrementalAlterConfigsRequest,
+	) (*kafka.IncrementalAlterConfigsResponse, error)
+}
+
+// Admin manages the topics of the cluster
+type Admin struct {
+	client adminClient
+	config *Config
+}
+
+// NewAdmin creates a new admin client with the given configuration, it connects with
+// the same SASL and TLS settings as the producer
+func NewAdmin(config *Config) (*Admin, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	// Use BootstrapServers if provided, otherwise fall back to Brokers
+	brokers := config.BootstrapServers
+	if len(brokers) == 0 {
+		brokers = config.Brokers
+	}
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("at least one bootstrap server must be specified")
+	}
+
+	// Set default values
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.ClientID == "" {
+		config.ClientID = "bi-kafka-admin"
+	}
+
+	transport, err := config.newTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Admin{
+		client: &kafka.Client{
+			Addr:      kafka.TCP(brokers...),
+			Timeout:   config.Timeout,
+			Transport: transport,
+		},
+		config: config,
+	}, nil
+}
+
+// NewAdminWithOptions creates a new admin client with the given options
+func NewAdminWithOptions(options ...Option) (*Admin, error) {
+	config := &Config{}
+
+	for _, option := range options {
+		option(config)
+	}
+
+	return NewAdmin(config)
+}
+
+// CreateTopics creates the topics which do not exist, the existing topics are left
+// unchanged
+func (a *Admin) CreateTopics(ctx context.Context, specs ...TopicSpec) error {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	req := &kafka.CreateTopicsRequest{Topics: make([]kafka.TopicConfig, len(specs))}
+	for i, spec := range specs {
+		if spec.Name == "" {
+			return fmt.Errorf("topic name cannot be empty for spec at index %d", i)
+		}
+
+		tc := kafka.TopicConfig{
+			Topic:             spec.Name,
+			NumPartitions:     -1,
+			ReplicationFactor: -1,
+		}
+		if spec.Partitions > 0 {
+			tc.NumPartitions = spec.Partitions
+		}
+		if spec.ReplicationFactor > 0 {
+			tc.ReplicationFactor = spec.ReplicationFactor
+		}
+		for _, name := range slices.Sorted(maps.Keys(spec.Configs)) {
+			tc.ConfigEntries = append(tc.ConfigEntries, kafka.ConfigEntry{ConfigName: name, ConfigValue: spec.Configs[name]})
+		}
+		req.Topics[i] = tc
+	}
+
+	res, err := a.client.CreateTopics(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to create topics: %w", err)
+	}
+
+	var errs []error
+	for _, spec := range specs {
+		if err := res.Errors[spec.Name]; err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+			errs = append(errs, fmt.Errorf("failed to create topic %s: %w", spec.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ListTopics returns the topics of the cluster sorted by name, the internal topics are
+// not included
+func (a *Admin) ListTopics(ctx context.Context) ([]TopicInfo, error) {
+	res, err := a.client.Metadata(ctx, &kafka.MetadataRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list topics: %w", err)
+	}
+
+	topics := make([]TopicInfo, 0, len(res.Topics))
+	for _, t := range res.Topics {
+		if t.Internal {
+			continue
+		}
+		if t.Error != nil {
+			return nil, fmt.Errorf("failed to list topic %s: %w", t.Name, t.Error)
+		}
+
+		topics = append(topics, topicInfo(t))
+	}
+	slices.SortFunc(topics, func(a, b TopicInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return topics, nil
+}
+
+func topicInfo(t kafka.Topic) TopicInfo {
+	info := TopicInfo{Name: t.Name, Partitions: len(t.Partitions)}
+	if len(t.Partitions) > 0 {
+		info.ReplicationFactor = len(t.Partitions[0].Replicas)
+	}
+
+	return info
+}
+
+// DescribeTopicConfigs returns the configs of the topic, or only the given ones if
+// names is not empty
+func (a *Admin) DescribeTopicConfigs(ctx context.Context, topic string, names ...string) (map[string]string, error) {
+	res, err := a.client.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{
+		Resources: []kafka.DescribeConfigRequestResource{{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: topic,
+			ConfigNames:  names,
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe topic %s: %w", topic, err)
+	}
+
+	configs := make(map[string]string)
+	for _, r := range res.Resources {
+		if r.Error != nil {
+			return nil, fmt.Errorf("failed to describe topic %s: %w", topic, r.Error)
+		}
+		for _, e := range r.ConfigEntries {
+			configs[e.ConfigName] = e.ConfigValue
+		}
+	}
+
+	return configs, nil
+}
+
+// AlterTopicConfigs sets the configs of the topic, the other configs are left unchanged
+func (a *Admin) AlterTopicConfigs(ctx context.Context, topic string, configs map[string]string) error {
+	if len(configs) == 0 {
+		return nil
+	}
+
+	resource := kafka.IncrementalAlterConfigsRequestResource{
+		ResourceType: kafka.ResourceTypeTopic,
+		ResourceName: topic,
+	}
+	for _, name := range slices.Sorted(maps.Keys(configs)) {
+		resource.Configs = append(resource.Configs, kafka.IncrementalAlterConfigsRequestConfig{
+			Name:            name,
+			Value:           configs[name],
+			ConfigOperation: kafka.ConfigOperationSet,
+		})
+	}
+
+	res, err := a.client.IncrementalAlterConfigs(ctx, &kafka.IncrementalAlterConfigsRequest{
+		Resources: []kafka.IncrementalAlterConfigsRequestResource{resource},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to alter topic %s: %w", topic, err)
+	}
+	for _, r := range res.Resources {
+		if r.Error != nil {
+			return fmt.Errorf("failed to alter topic %s: %w", topic, r.Error)
+		}
+	}
+
+	return nil
+}
+
+// ValidateTopics checks that the topics exist with at least the partitions and the
+// replication factor of their spec, and with the configs of their spec. It is meant
+// to be called on startup, the returned error lists all the invalid topics.
+func (a *Admin) ValidateTopics(ctx context.Context, specs ...TopicSpec) error {
+	// An empty request returns all the topics.
+	if len(specs) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		names = append(names, spec.Name)
+	}
+	res, err := a.client.Metadata(ctx, &kafka.MetadataRequest{Topics: names})
+	if err != nil {
+		return fmt.Errorf("failed to describe topics: %w", err)
+	}
+	topics := make(map[string]kafka.Topic, len(res.Topics))
+	for _, t := range res.Topics {
+		topics[t.Name] = t
+	}
+
+	var errs []error
+	for _, spec := range specs {
+		t, ok := topics[spec.Name]
+		switch {
+		case !ok, errors.Is(t.Error, kafka.UnknownTopicOrPartition):
+			errs = append(errs, fmt.Errorf("%w: %s", ErrTopicNotFound, spec.Name))
+
+			continue
+		case t.Error != nil:
+			errs = append(errs, fmt.Errorf("failed to describe topic %s: %w", spec.Name, t.Error))
+
+			continue
+		}
+
+		info := topicInfo(t)
+		if info.Partitions < spec.Partitions {
+			errs = append(errs, fmt.Errorf(
+				"%w: %s has %d partitions, want %d", ErrTopicMismatch, spec.Name, info.Partitions, spec.Partitions,
+			))
+		}
+		if info.ReplicationFactor < spec.ReplicationFactor {
+			errs = append(errs, fmt.Errorf(
+				"%w: %s has replication factor %d, want %d",
+				ErrTopicMismatch, spec.Name, info.ReplicationFactor, spec.ReplicationFactor,
+			))
+		}
+		if len(spec.Configs) == 0 {
+			continue
+		}
+
+		names := slices.Sorted(maps.Keys(spec.Configs))
+		configs, err := a.DescribeTopicConfigs(ctx, spec.Name, names...)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+		for _, name := range names {
+			if configs[name] != spec.Configs[name] {
+				errs = append(errs, fmt.Errorf(
+					"%w: %s has %s=%q, want %q", ErrTopicMismatch, spec.Name, name, configs[name], spec.Configs[name],
+				))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
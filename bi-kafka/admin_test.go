@@ -0,0 +1,237 @@
+package bikafka
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCluster is an in-memory cluster serving the admin requests
+type fakeCluster struct {
+	topics  map[string]TopicSpec
+	errors  map[string]error
+	creates []*kafka.CreateTopicsRequest
+}
+
+func newFakeCluster(specs ...TopicSpec) *fakeCluster {
+	c := &fakeCluster{topics: make(map[string]TopicSpec), errors: make(map[string]error)}
+	for _, spec := range specs {
+		c.topics[spec.Name] = spec
+	}
+
+	return c
+}
+
+func (c *fakeCluster) CreateTopics(_ context.Context, req *kafka.CreateTopicsRequest) (*kafka.CreateTopicsResponse, error) {
+	c.creates = append(c.creates, req)
+
+	res := &kafka.CreateTopicsResponse{Errors: make(map[string]error)}
+	for _, tc := range req.Topics {
+		if _, ok := c.topics[tc.Topic]; ok {
+			res.Errors[tc.Topic] = kafka.TopicAlreadyExists
+
+			continue
+		}
+		if tc.ReplicationFactor > 3 {
+			res.Errors[tc.Topic] = kafka.InvalidReplicationFactor
+
+			continue
+		}
+
+		spec := TopicSpec{Name: tc.Topic, Partitions: 1, ReplicationFactor: 1, Configs: map[string]string{}}
+		if tc.NumPartitions > 0 {
+			spec.Partitions = tc.NumPartitions
+		}
+		if tc.ReplicationFactor > 0 {
+			spec.ReplicationFactor = tc.ReplicationFactor
+		}
+		for _, e := range tc.ConfigEntries {
+			spec.Configs[e.ConfigName] = e.ConfigValue
+		}
+		c.topics[tc.Topic] = spec
+	}
+
+	return res, nil
+}
+
+func (c *fakeCluster) Metadata(_ context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error) {
+	res := &kafka.MetadataResponse{}
+	names := req.Topics
+	if len(names) == 0 {
+		res.Topics = append(res.Topics, kafka.Topic{Name: "__consumer_offsets", Internal: true})
+		names = slices.Collect(maps.Keys(c.topics))
+	}
+	for _, name := range names {
+		spec, ok := c.topics[name]
+		if !ok {
+			res.Topics = append(res.Topics, kafka.Topic{Name: name, Error: kafka.UnknownTopicOrPartition})
+
+			continue
+		}
+		t := kafka.Topic{Name: spec.Name, Error: c.errors[name]}
+		for i := range spec.Partitions {
+			t.Partitions = append(t.Partitions, kafka.Partition{
+				Topic:    spec.Name,
+				ID:       i,
+				Replicas: make([]kafka.Broker, spec.ReplicationFactor),
+			})
+		}
+		res.Topics = append(res.Topics, t)
+	}
+
+	return res, nil
+}
+
+func (c *fakeCluster) DescribeConfigs(
+	_ context.Context, req *kafka.DescribeConfigsRequest,
+) (*kafka.DescribeConfigsResponse, error) {
+	res := &kafka.DescribeConfigsResponse{}
+	for _, r := range req.Resources {
+		rr := kafka.DescribeConfigResponseResource{ResourceName: r.ResourceName}
+		spec, ok := c.topics[r.ResourceName]
+		if !ok {
+			rr.Error = kafka.UnknownTopicOrPartition
+		}
+		for name, value := range spec.Configs {
+			if len(r.ConfigNames) == 0 || slices.Contains(r.ConfigNames, name) {
+				rr.ConfigEntries = append(rr.ConfigEntries, kafka.DescribeConfigResponseConfigEntry{
+					ConfigName:  name,
+					ConfigValue: value,
+				})
+			}
+		}
+		res.Resources = append(res.Resources, rr)
+	}
+
+	return res, nil
+}
+
+func (c *fakeCluster) IncrementalAlterConfigs(
+	_ context.Context, req *kafka.IncrementalAlterConfigsRequest,
+) (*kafka.IncrementalAlterConfigsResponse, error) {
+	res := &kafka.IncrementalAlterConfigsResponse{}
+	for _, r := range req.Resources {
+		rr := kafka.IncrementalAlterConfigsResponseResource{ResourceName: r.ResourceName}
+		if spec, ok := c.topics[r.ResourceName]; ok {
+			for _, cfg := range r.Configs {
+				spec.Configs[cfg.Name] = cfg.Value
+			}
+		} else {
+			rr.Error = kafka.UnknownTopicOrPartition
+		}
+		res.Resources = append(res.Resources, rr)
+	}
+
+	return res, nil
+}
+
+func TestNewAdmin(t *testing.T) {
+	_, err := NewAdmin(nil)
+	assert.Error(t, err)
+
+	_, err = NewAdminWithOptions()
+	assert.ErrorContains(t, err, "at least one bootstrap server")
+
+	a, err := NewAdminWithOptions(WithBootstrapServers("localhost:9092"), WithSCRAM(SASLScramSHA512, "user", "pass"), WithTLS())
+	require.NoError(t, err)
+
+	client, ok := a.client.(*kafka.Client)
+	require.True(t, ok)
+	transport, ok := client.Transport.(*kafka.Transport)
+	require.True(t, ok)
+	assert.Equal(t, "bi-kafka-admin", transport.ClientID)
+	assert.Equal(t, "SCRAM-SHA-512", transport.SASL.Name())
+	assert.NotNil(t, transport.TLS)
+}
+
+func TestAdmin(t *testing.T) {
+	ctx := context.Background()
+	cluster := newFakeCluster(TopicSpec{
+		Name:              "orders",
+		Partitions:        6,
+		ReplicationFactor: 3,
+		Configs:           map[string]string{"retention.ms": "86400000"},
+	})
+	a := &Admin{client: cluster, config: &Config{}}
+
+	t.Run("create topics is idempotent", func(t *testing.T) {
+		err := a.CreateTopics(ctx,
+			TopicSpec{Name: "orders", Partitions: 12},
+			TopicSpec{Name: "payments", Partitions: 3, ReplicationFactor: 2, Configs: map[string]string{"cleanup.policy": "compact"}},
+		)
+		require.NoError(t, err)
+
+		req := cluster.creates[0]
+		require.Len(t, req.Topics, 2)
+		assert.Equal(t, -1, req.Topics[0].ReplicationFactor)
+		assert.Equal(t, []kafka.ConfigEntry{{ConfigName: "cleanup.policy", ConfigValue: "compact"}}, req.Topics[1].ConfigEntries)
+
+		// The existing topic is not changed.
+		assert.Equal(t, 6, cluster.topics["orders"].Partitions)
+
+		err = a.CreateTopics(ctx, TopicSpec{Name: "refunds", ReplicationFactor: 5})
+		assert.ErrorIs(t, err, kafka.InvalidReplicationFactor)
+		assert.ErrorContains(t, err, "failed to create topic refunds")
+
+		assert.ErrorContains(t, a.CreateTopics(ctx, TopicSpec{}), "topic name cannot be empty")
+	})
+
+	t.Run("list topics", func(t *testing.T) {
+		topics, err := a.ListTopics(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []TopicInfo{
+			{Name: "orders", Partitions: 6, ReplicationFactor: 3},
+			{Name: "payments", Partitions: 3, ReplicationFactor: 2},
+		}, topics)
+	})
+
+	t.Run("describe and alter configs", func(t *testing.T) {
+		require.NoError(t, a.AlterTopicConfigs(ctx, "orders", map[string]string{"retention.ms": "3600000"}))
+
+		configs, err := a.DescribeTopicConfigs(ctx, "orders")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"retention.ms": "3600000"}, configs)
+
+		_, err = a.DescribeTopicConfigs(ctx, "refunds")
+		assert.ErrorIs(t, err, kafka.UnknownTopicOrPartition)
+		assert.ErrorIs(t, a.AlterTopicConfigs(ctx, "refunds", map[string]string{"retention.ms": "1"}), kafka.UnknownTopicOrPartition)
+	})
+
+	t.Run("validate topics", func(t *testing.T) {
+		require.NoError(t, a.ValidateTopics(ctx,
+			TopicSpec{Name: "orders", Partitions: 6, Configs: map[string]string{"retention.ms": "3600000"}},
+			TopicSpec{Name: "payments"},
+		))
+
+		err := a.ValidateTopics(ctx,
+			TopicSpec{Name: "orders", Partitions: 12, ReplicationFactor: 3},
+			TopicSpec{Name: "payments", Configs: map[string]string{"cleanup.policy": "delete"}},
+			TopicSpec{Name: "refunds"},
+		)
+		assert.ErrorIs(t, err, ErrTopicNotFound)
+		assert.ErrorIs(t, err, ErrTopicMismatch)
+		assert.ErrorContains(t, err, "orders has 6 partitions, want 12")
+		assert.ErrorContains(t, err, `payments has cleanup.policy="compact", want "delete"`)
+		assert.ErrorContains(t, err, "topic not found: refunds")
+	})
+
+	t.Run("validate topics ignores the errors of other topics", func(t *testing.T) {
+		cluster.topics["broken"] = TopicSpec{Name: "broken", Partitions: 1, ReplicationFactor: 1}
+		cluster.errors["broken"] = kafka.LeaderNotAvailable
+		defer delete(cluster.topics, "broken")
+
+		_, err := a.ListTopics(ctx)
+		assert.ErrorIs(t, err, kafka.LeaderNotAvailable)
+
+		require.NoError(t, a.ValidateTopics(ctx, TopicSpec{Name: "orders"}))
+
+		err = a.ValidateTopics(ctx, TopicSpec{Name: "orders"}, TopicSpec{Name: "broken"})
+		assert.ErrorIs(t, err, kafka.LeaderNotAvailable)
+		assert.ErrorContains(t, err, "failed to describe topic broken")
+	})
+}
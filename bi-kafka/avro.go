@@ -0,0 +1,351 @@
+package bikafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"time"
+)
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+func avroMarshal(v any) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("cannot marshal nil %T", v)
+		}
+		rv = rv.Elem()
+	}
+
+	return avroEncode(nil, rv)
+}
+
+func avroUnmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("cannot unmarshal into non-pointer %T", v)
+	}
+
+	d := &avroDecoder{data: data}
+
+	return d.decode(rv.Elem())
+}
+
+func avroLong(buf []byte, n int64) []byte {
+	return binary.AppendVarint(buf, n)
+}
+
+func avroEncode(buf []byte, v reflect.Value) ([]byte, error) {
+	if v.Type() == timeType {
+		//nolint:forcetypeassert
+		return avroLong(buf, v.Interface().(time.Time).UnixMilli()), nil
+	}
+	if v.Type() == bytesType {
+		buf = avroLong(buf, int64(v.Len()))
+
+		return append(buf, v.Bytes()...), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, 1), nil
+		}
+
+		return append(buf, 0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return avroLong(buf, v.Int()), nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return avroLong(buf, int64(v.Uint())), nil
+	case reflect.Float32:
+		return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(v.Float()))), nil
+	case reflect.Float64:
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v.Float())), nil
+	case reflect.String:
+		buf = avroLong(buf, int64(v.Len()))
+
+		return append(buf, v.String()...), nil
+	case reflect.Pointer:
+		// a union of null and the element
+		if v.IsNil() {
+			return avroLong(buf, 0), nil
+		}
+
+		return avroEncode(avroLong(buf, 1), v.Elem())
+	case reflect.Struct:
+		var err error
+		for i := range v.NumField() {
+			if !avroField(v.Type().Field(i)) {
+				continue
+			}
+			if buf, err = avroEncode(buf, v.Field(i)); err != nil {
+				return nil, err
+			}
+		}
+
+		return buf, nil
+	case reflect.Slice, reflect.Array:
+		// arrays are written as a single block followed by the empty block
+		var err error
+		if v.Len() > 0 {
+			buf = avroLong(buf, int64(v.Len()))
+			for i := range v.Len() {
+				if buf, err = avroEncode(buf, v.Index(i)); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		return avroLong(buf, 0), nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("avro maps must have string keys, not %s", v.Type().Key())
+		}
+
+		var err error
+		if v.Len() > 0 {
+			buf = avroLong(buf, int64(v.Len()))
+			iter := v.MapRange()
+			for iter.Next() {
+				if buf, err = avroEncode(buf, iter.Key()); err != nil {
+					return nil, err
+				}
+				if buf, err = avroEncode(buf, iter.Value()); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		return avroLong(buf, 0), nil
+	}
+
+	return nil, fmt.Errorf("unsupported avro type %s", v.Type())
+}
+
+// avroField reports whether the struct field is a record field
+func avroField(f reflect.StructField) bool {
+	return f.IsExported() && f.Tag.Get("avro") != "-"
+}
+
+type avroDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *avroDecoder) long() (int64, error) {
+	n, size := binary.Varint(d.data[d.pos:])
+	if size <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	d.pos += size
+
+	return n, nil
+}
+
+func (d *avroDecoder) bytes(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+
+	return b, nil
+}
+
+// blockCount returns the count of the next block of an array or a map. A negative
+// count is followed by the size of the block in bytes. As each element takes at least
+// one byte, the count cannot be more than the bytes left.
+func (d *avroDecoder) blockCount() (int, error) {
+	n, err := d.long()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		n = -n
+		if _, err := d.long(); err != nil {
+			return 0, err
+		}
+	}
+	if n < 0 || n > int64(len(d.data)-d.pos) {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	return int(n), nil
+}
+
+// element decodes an element of an array or a map. Elements which take no bytes are
+// not supported, otherwise a short message could claim any number of them.
+func (d *avroDecoder) element(v reflect.Value) error {
+	pos := d.pos
+	if err := d.decode(v); err != nil {
+		return err
+	}
+	if d.pos == pos {
+		return fmt.Errorf("avro element %s takes no bytes", v.Type())
+	}
+
+	return nil
+}
+
+func (d *avroDecoder) decode(v reflect.Value) error {
+	if v.Type() == timeType {
+		n, err := d.long()
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(time.UnixMilli(n)))
+
+		return nil
+	}
+	if v.Type() == bytesType {
+		n, err := d.long()
+		if err != nil {
+			return err
+		}
+		b, err := d.bytes(int(n))
+		if err != nil {
+			return err
+		}
+		v.SetBytes(append([]byte(nil), b...))
+
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := d.bytes(1)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b[0] != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := d.long()
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		n, err := d.long()
+		if err != nil {
+			return err
+		}
+		v.SetUint(uint64(n))
+	case reflect.Float32:
+		b, err := d.bytes(4)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+	case reflect.Float64:
+		b, err := d.bytes(8)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+	case reflect.String:
+		n, err := d.long()
+		if err != nil {
+			return err
+		}
+		b, err := d.bytes(int(n))
+		if err != nil {
+			return err
+		}
+		v.SetString(string(b))
+	case reflect.Pointer:
+		idx, err := d.long()
+		if err != nil {
+			return err
+		}
+		if idx == 0 {
+			v.SetZero()
+
+			return nil
+		}
+		elem := reflect.New(v.Type().Elem())
+		if err := d.decode(elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if !avroField(v.Type().Field(i)) {
+				continue
+			}
+			if err := d.decode(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		for {
+			n, err := d.blockCount()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return nil
+			}
+			for range n {
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if err := d.element(elem); err != nil {
+					return err
+				}
+				v.Set(reflect.Append(v, elem))
+			}
+		}
+	case reflect.Array:
+		i := 0
+		for {
+			n, err := d.blockCount()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return nil
+			}
+			for range n {
+				if i >= v.Len() {
+					return errors.New("avro array is longer than the Go array")
+				}
+				if err := d.element(v.Index(i)); err != nil {
+					return err
+				}
+				i++
+			}
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		for {
+			n, err := d.blockCount()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return nil
+			}
+			for range n {
+				key := reflect.New(v.Type().Key()).Elem()
+				if err := d.element(key); err != nil {
+					return err
+				}
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if err := d.decode(elem); err != nil {
+					return err
+				}
+				v.SetMapIndex(key, elem)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported avro type %s", v.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package bikafka
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Partitioner selects how the producer assigns the messages to the partitions
+type Partitioner string
+
+const (
+	// PartitionerRoundRobin spreads the messages over the partitions, ignoring their
+	// keys. It is the default.
+	PartitionerRoundRobin Partitioner = "round-robin"
+	// PartitionerMurmur2 hashes the keys like the Java client, so the messages with the
+	// same key land on the same partition as the ones produced by the JVM services
+	PartitionerMurmur2 Partitioner = "murmur2"
+	// PartitionerCRC32 hashes the keys like librdkafka
+	PartitionerCRC32 Partitioner = "crc32"
+	// PartitionerLeastBytes sends the messages to the partition with the least bytes
+	// written by the producer
+	PartitionerLeastBytes Partitioner = "least-bytes"
+	// PartitionerSticky hashes the keys like PartitionerMurmur2 and sends the messages
+	// without a key to the same partition until a batch is full
+	PartitionerSticky Partitioner = "sticky"
+)
+
+// PartitionFunc returns the partition of the message, one of partitions. The version
+// of the message is parsed from its version header.
+type PartitionFunc func(msg *Message, partitions []int) int
+
+// balancer returns the balancer of the writer, PartitionFunc takes precedence over
+// Partitioner
+func (c *Config) balancer() (kafka.Balancer, error) {
+	if c.PartitionFunc != nil {
+		fn := c.PartitionFunc
+
+		return kafka.BalancerFunc(func(m kafka.Message, partitions ...int) int {
+			return fn(messageFromKafka(m), partitions)
+		}), nil
+	}
+
+	switch c.Partitioner {
+	case "", PartitionerRoundRobin:
+		return &kafka.RoundRobin{}, nil
+	case PartitionerMurmur2:
+		return kafka.Murmur2Balancer{}, nil
+	case PartitionerCRC32:
+		return kafka.CRC32Balancer{}, nil
+	case PartitionerLeastBytes:
+		return &kafka.LeastBytes{}, nil
+	case PartitionerSticky:
+		return &stickyBalancer{batchSize: c.BatchSize}, nil
+	default:
+		return nil, fmt.Errorf("unsupported partitioner: %s", c.Partitioner)
+	}
+}
+
+// stickyBalancer keeps the messages without a key on a random partition for
+// batchSize messages, so they are sent in fewer and larger batches
+type stickyBalancer struct {
+	keyed     kafka.Murmur2Balancer
+	batchSize int
+
+	mtx       sync.Mutex
+	partition int
+	count     int
+}
+
+func (b *stickyBalancer) Balance(msg kafka.Message, partitions ...int) int {
+	if msg.Key != nil {
+		return b.keyed.Balance(msg, partitions...)
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.count == 0 || b.count >= b.batchSize || !slices.Contains(partitions, b.partition) {
+		b.partition = partitions[rand.IntN(len(partitions))]
+		b.count = 0
+	}
+	b.count++
+
+	return b.partition
+}
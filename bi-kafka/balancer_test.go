@@ -0,0 +1,82 @@
+package bikafka
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProducer_Partitioner(t *testing.T) {
+	tests := []struct {
+		partitioner Partitioner
+		balancer    kafka.Balancer
+	}{
+		{"", &kafka.RoundRobin{}},
+		{PartitionerRoundRobin, &kafka.RoundRobin{}},
+		{PartitionerMurmur2, kafka.Murmur2Balancer{}},
+		{PartitionerCRC32, kafka.CRC32Balancer{}},
+		{PartitionerLeastBytes, &kafka.LeastBytes{}},
+		{PartitionerSticky, &stickyBalancer{batchSize: 100}},
+	}
+	for _, tt := range tests {
+		p, err := NewProducerWithOptions(WithBootstrapServers("localhost:9092"), WithPartitioner(tt.partitioner))
+		require.NoError(t, err)
+		assert.Equal(t, tt.balancer, p.writer.Balancer, tt.partitioner)
+	}
+
+	_, err := NewProducerWithOptions(WithBootstrapServers("localhost:9092"), WithPartitioner("random"))
+	assert.ErrorContains(t, err, "unsupported partitioner")
+}
+
+func TestPartitionFunc(t *testing.T) {
+	var got *Message
+	p, err := NewProducerWithOptions(
+		WithBootstrapServers("localhost:9092"),
+		WithPartitioner(PartitionerMurmur2),
+		WithPartitionFunc(func(msg *Message, partitions []int) int {
+			got = msg
+
+			return partitions[len(partitions)-1]
+		}),
+	)
+	require.NoError(t, err)
+
+	partition := p.writer.Balancer.Balance(kafka.Message{
+		Topic:   "orders",
+		Key:     []byte("restaurant-1"),
+		Headers: []kafka.Header{{Key: version, Value: []byte("2")}},
+	}, 0, 1, 2)
+	assert.Equal(t, 2, partition)
+	require.NotNil(t, got)
+	assert.Equal(t, []byte("restaurant-1"), got.Key)
+	assert.Equal(t, "2", got.Version)
+}
+
+func TestStickyBalancer(t *testing.T) {
+	b := &stickyBalancer{batchSize: 3}
+	partitions := []int{0, 1, 2, 3, 4, 5, 6, 7}
+
+	t.Run("keys are hashed like murmur2", func(t *testing.T) {
+		for _, key := range []string{"restaurant-1", "restaurant-2", "order-42"} {
+			msg := kafka.Message{Key: []byte(key)}
+			assert.Equal(t, kafka.Murmur2Balancer{}.Balance(msg, partitions...), b.Balance(msg, partitions...))
+		}
+	})
+
+	t.Run("messages without key stick to a partition for a batch", func(t *testing.T) {
+		first := b.Balance(kafka.Message{}, partitions...)
+		assert.Equal(t, first, b.Balance(kafka.Message{}, partitions...))
+		assert.Equal(t, first, b.Balance(kafka.Message{}, partitions...))
+		assert.Equal(t, 3, b.count)
+
+		b.Balance(kafka.Message{}, partitions...)
+		assert.Equal(t, 1, b.count)
+	})
+
+	t.Run("unavailable partition is not used", func(t *testing.T) {
+		b.partition, b.count = 9, 1
+		assert.Contains(t, partitions, b.Balance(kafka.Message{}, partitions...))
+	})
+}
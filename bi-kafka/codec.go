@@ -0,0 +1,74 @@
+package bikafka
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec marshals the values of typed events
+type Codec interface {
+	// ContentType identifies the codec in the content-type header of the messages
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec marshals the values with encoding/json
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// ProtoCodec marshals the values which are proto messages
+type ProtoCodec struct{}
+
+func (ProtoCodec) ContentType() string {
+	return "application/x-protobuf"
+}
+
+func (ProtoCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a proto message", v)
+	}
+
+	return proto.Marshal(m)
+}
+
+func (ProtoCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not a proto message", v)
+	}
+
+	return proto.Unmarshal(data, m)
+}
+
+// AvroCodec marshals the values in the Avro binary encoding. The schema is derived
+// from the Go type: struct fields are record fields in their order, pointers are
+// unions of null and the element, time.Time is a timestamp-millis long, and maps
+// must have string keys. Fields tagged `avro:"-"` are skipped.
+type AvroCodec struct{}
+
+func (AvroCodec) ContentType() string {
+	return "avro/binary"
+}
+
+func (AvroCodec) Marshal(v any) ([]byte, error) {
+	return avroMarshal(v)
+}
+
+func (AvroCodec) Unmarshal(data []byte, v any) error {
+	return avroUnmarshal(data, v)
+}
@@ -0,0 +1,459 @@
+package bikafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Handler processes a consumed message. If it returns an error, the message is
+// retried and then sent to the next retry topic or to the dead letter topic. If
+// there is none, the consumer stops without committing it.
+type Handler func(ctx context.Context, msg *Message) error
+
+// reader is the part of kafka.Reader used by the consumer
+type reader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Consumer consumes messages of a consumer group with at-least-once semantics: the
+// offset of a message is committed only after it and all the messages before it in
+// its partition are handled successfully
+type Consumer struct {
+	reader reader
+	// retryReaders fetch the retry topics, in the order of Config.RetryTopics
+	retryReaders []reader
+	writer       messageWriter
+	handler      Handler
+	config       *Config
+}
+
+// NewConsumer creates a new Kafka consumer with the given configuration
+func NewConsumer(config *Config, handler Handler) (*Consumer, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	// Use BootstrapServers if provided, otherwise fall back to Brokers
+	brokers := config.BootstrapServers
+	if len(brokers) == 0 {
+		brokers = config.Brokers
+	}
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("at least one bootstrap server must be specified")
+	}
+	if config.GroupID == "" {
+		return nil, fmt.Errorf("group ID cannot be empty")
+	}
+	if len(config.Topics) == 0 {
+		return nil, fmt.Errorf("at least one topic must be specified")
+	}
+
+	// Set default values
+	if config.Timeout == 0 {
+		config.Timeout = 3 * time.Second
+	}
+	if config.ClientID == "" {
+		config.ClientID = "bi-kafka-consumer"
+	}
+
+	dialer, err := config.newDialer()
+	if err != nil {
+		return nil, err
+	}
+
+	newReader := func(topics ...string) *kafka.Reader {
+		readerConfig := kafka.ReaderConfig{
+			Brokers:        brokers,
+			GroupID:        config.GroupID,
+			GroupTopics:    topics,
+			Dialer:         dialer,
+			CommitInterval: config.CommitInterval,
+		}
+		if config.MaxMessageBytes > 0 {
+			readerConfig.MaxBytes = config.MaxMessageBytes
+		}
+
+		return kafka.NewReader(readerConfig)
+	}
+
+	c := newConsumer(newReader(config.Topics...), handler, config)
+	// Each retry topic has its own reader, so the messages waiting for their delay
+	// do not hold back the other topics.
+	for _, rt := range config.RetryTopics {
+		c.retryReaders = append(c.retryReaders, newReader(rt.Topic))
+	}
+	if len(config.RetryTopics) > 0 || config.DeadLetterTopic != "" {
+		transport, err := config.newTransport()
+		if err != nil {
+			return nil, err
+		}
+		c.writer = &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			RequiredAcks: kafka.RequireAll,
+			Transport:    transport,
+		}
+	}
+
+	return c, nil
+}
+
+// NewConsumerWithOptions creates a new consumer with the given options
+func NewConsumerWithOptions(handler Handler, options ...Option) (*Consumer, error) {
+	config := &Config{}
+
+	for _, option := range options {
+		option(config)
+	}
+
+	return NewConsumer(config, handler)
+}
+
+func newConsumer(r reader, handler Handler, config *Config) *Consumer {
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	if config.PartitionQueueSize <= 0 {
+		config.PartitionQueueSize = 100
+	}
+
+	return &Consumer{
+		reader:  r,
+		handler: handler,
+		config:  config,
+	}
+}
+
+// Run consumes the messages until ctx is done or a message fails after all its
+// retries. Each partition has its own queue and workers, so a slow partition does
+// not hold back the others until its queue is full, and each retry topic is fetched
+// by its own loop. On shutdown it stops fetching, waits for the messages being
+// handled and commits their offsets. The queued messages are left to be fetched
+// again. It returns nil if it stops because ctx is done.
+func (c *Consumer) Run(ctx context.Context) error {
+	// The handlers and the commits outlive ctx, so the shutdown is graceful.
+	workCtx := context.WithoutCancel(ctx)
+	loopCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	readers := append([]reader{c.reader}, c.retryReaders...)
+	var (
+		wg        sync.WaitGroup
+		fetchErrs = make([]error, len(readers))
+	)
+	for i, r := range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// A failed reader stops the others.
+			if fetchErrs[i] = c.consume(workCtx, loopCtx, cancel, &wg, r); fetchErrs[i] != nil {
+				cancel(fetchErrs[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(fetchErrs...); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return context.Cause(loopCtx)
+}
+
+// consume fetches the messages of r and queues them to their partition until
+// loopCtx is done or fetching fails.
+func (c *Consumer) consume(
+	workCtx, loopCtx context.Context, cancel context.CancelCauseFunc, wg *sync.WaitGroup, r reader,
+) error {
+	var (
+		fetchErr   error
+		stop       = make(chan struct{})
+		partitions = make(map[topicPartition]*partition)
+	)
+
+loop:
+	for {
+		m, err := r.FetchMessage(loopCtx)
+		if err != nil {
+			if loopCtx.Err() == nil {
+				fetchErr = fmt.Errorf("failed to fetch message: %w", err)
+			}
+
+			break
+		}
+
+		tp := topicPartition{topic: m.Topic, partition: m.Partition}
+		p, ok := partitions[tp]
+		if !ok {
+			p = newPartition(r, c.config.Concurrency, c.config.PartitionQueueSize)
+			partitions[tp] = p
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.dispatch(workCtx, loopCtx, cancel, stop, wg, p)
+			}()
+		}
+
+		select {
+		case p.queue <- m:
+		case <-loopCtx.Done():
+			break loop
+		}
+	}
+
+	close(stop)
+
+	return fetchErr
+}
+
+// dispatch starts a worker for each queued message of the partition, at most
+// Concurrency at the same time, until stop is closed or loopCtx is done. The
+// messages of a retry topic are started after its delay.
+func (c *Consumer) dispatch(
+	workCtx, loopCtx context.Context, cancel context.CancelCauseFunc, stop <-chan struct{},
+	wg *sync.WaitGroup, p *partition,
+) {
+	for {
+		var m kafka.Message
+		select {
+		case m = <-p.queue:
+		case <-stop:
+			return
+		case <-loopCtx.Done():
+			return
+		}
+
+		// The messages of a partition are due in order, so waiting here only holds
+		// back this partition and no slot is taken while waiting.
+		if tier := c.retryTier(m.Topic); tier >= 0 {
+			if !sleepUntil(loopCtx, stop, m.Time.Add(c.config.RetryTopics[tier].Delay)) {
+				return
+			}
+		}
+
+		select {
+		case p.slots <- struct{}{}:
+		case <-stop:
+			return
+		case <-loopCtx.Done():
+			return
+		}
+		p.track(m.Offset)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-p.slots }()
+
+			if err := c.handle(workCtx, loopCtx, m); err != nil {
+				cancel(err)
+
+				return
+			}
+			if err := p.done(workCtx, m); err != nil {
+				cancel(fmt.Errorf("failed to commit message: %w", err))
+			}
+		}()
+	}
+}
+
+// handle runs the handler with the retries and forwards the message if it still
+// fails. The retries stop when loopCtx is done.
+func (c *Consumer) handle(ctx, loopCtx context.Context, m kafka.Message) error {
+	msg := messageFromKafka(m)
+
+	// Messages of a retry topic are handled as if they were consumed from their
+	// original topic.
+	tier := c.retryTier(m.Topic)
+	if tier >= 0 {
+		if topic, ok := headerValue(m.Headers, HeaderOriginalTopic); ok {
+			msg.Topic = topic
+		}
+	}
+
+	// The span continues the trace of the producer and records the last error of the
+	// handler, even if the message is forwarded.
+	ctx, span := c.startProcess(ctx, msg)
+	var err error
+	defer func() { endSpan(span, err) }()
+
+	for attempt := 0; ; attempt++ {
+		if err = c.handler(ctx, msg); err == nil {
+			return nil
+		}
+		if attempt >= c.config.MaxRetries {
+			break
+		}
+
+		t := time.NewTimer(c.config.RetryBackoff)
+		select {
+		case <-t.C:
+		case <-loopCtx.Done():
+			t.Stop()
+
+			return errors.Join(err, context.Cause(loopCtx))
+		}
+	}
+
+	return c.forward(ctx, m, tier+1, fmt.Errorf("failed to handle message %s/%d/%d: %w", m.Topic, m.Partition, m.Offset, err))
+}
+
+// forward sends a failed message to the next retry topic, or to the dead letter topic
+// after the last one. It returns cause if there is nowhere to send it.
+func (c *Consumer) forward(ctx context.Context, m kafka.Message, next int, cause error) error {
+	fm := kafka.Message{
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: failureHeaders(m, cause, true),
+		Time:    time.Now(),
+	}
+	switch {
+	case next < len(c.config.RetryTopics):
+		fm.Topic = c.config.RetryTopics[next].Topic
+		fm.Headers = append(fm.Headers, kafka.Header{Key: HeaderRetryAttempt, Value: []byte(strconv.Itoa(next + 1))})
+	case c.config.DeadLetterTopic != "":
+		fm.Topic = c.config.DeadLetterTopic
+	default:
+		return cause
+	}
+
+	if err := c.writer.WriteMessages(ctx, fm); err != nil {
+		return errors.Join(cause, fmt.Errorf("failed to forward message to topic %s: %w", fm.Topic, err))
+	}
+
+	return nil
+}
+
+// retryTier returns the index of the retry topic, or -1 if it is not a retry topic
+func (c *Consumer) retryTier(topic string) int {
+	for i, rt := range c.config.RetryTopics {
+		if rt.Topic == topic {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// sleepUntil waits until t and reports false if ctx is done or stop is closed first
+func sleepUntil(ctx context.Context, stop <-chan struct{}, t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Close closes the consumer
+func (c *Consumer) Close() error {
+	err := c.reader.Close()
+	for _, r := range c.retryReaders {
+		err = errors.Join(err, r.Close())
+	}
+	if c.writer != nil {
+		err = errors.Join(err, c.writer.Close())
+	}
+
+	return err
+}
+
+// messageFromKafka converts a consumed message, the version is parsed from the
+// version header
+func messageFromKafka(m kafka.Message) *Message {
+	msg := &Message{
+		Topic:     m.Topic,
+		Key:       m.Key,
+		Value:     m.Value,
+		Headers:   m.Headers,
+		Timestamp: m.Time,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+	}
+	for _, h := range m.Headers {
+		if h.Key == version {
+			msg.Version = string(h.Value)
+		}
+	}
+
+	return msg
+}
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// partition queues the fetched messages of a partition and tracks the ones being
+// handled, so only contiguous offsets are committed
+type partition struct {
+	// r fetched the messages and commits their offsets
+	r         reader
+	queue     chan kafka.Message
+	slots     chan struct{}
+	mtx       sync.Mutex
+	pending   []int64
+	completed map[int64]bool
+}
+
+func newPartition(r reader, concurrency, queueSize int) *partition {
+	return &partition{
+		r:         r,
+		queue:     make(chan kafka.Message, queueSize),
+		slots:     make(chan struct{}, concurrency),
+		completed: make(map[int64]bool),
+	}
+}
+
+// track adds a fetched offset, offsets are fetched in order
+func (p *partition) track(offset int64) {
+	p.mtx.Lock()
+	p.pending = append(p.pending, offset)
+	p.mtx.Unlock()
+}
+
+// done marks the message as handled and commits the highest offset whose previous
+// offsets are all handled
+func (p *partition) done(ctx context.Context, m kafka.Message) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.completed[m.Offset] = true
+
+	last := int64(-1)
+	for len(p.pending) > 0 && p.completed[p.pending[0]] {
+		last = p.pending[0]
+		delete(p.completed, last)
+		p.pending = p.pending[1:]
+	}
+	if last < 0 {
+		return nil
+	}
+
+	return p.r.CommitMessages(ctx, kafka.Message{
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    last,
+	})
+}
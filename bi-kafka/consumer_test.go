@@ -0,0 +1,268 @@
+package bikafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeReader serves the queued messages and records the commits
+type fakeReader struct {
+	messages chan kafka.Message
+	mu       sync.Mutex
+	commits  []kafka.Message
+	closed   bool
+}
+
+func newFakeReader(msgs ...kafka.Message) *fakeReader {
+	r := &fakeReader{messages: make(chan kafka.Message, len(msgs))}
+	for _, m := range msgs {
+		r.messages <- m
+	}
+
+	return r
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case m := <-r.messages:
+		return m, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commits = append(r.commits, msgs...)
+
+	return nil
+}
+
+func (r *fakeReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+
+	return nil
+}
+
+// committed returns the last committed offset of each partition
+func (r *fakeReader) committed() map[int]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	offsets := make(map[int]int64)
+	for _, m := range r.commits {
+		offsets[m.Partition] = m.Offset
+	}
+
+	return offsets
+}
+
+func testMessages(partition int, from, to int64) []kafka.Message {
+	var msgs []kafka.Message
+	for offset := from; offset <= to; offset++ {
+		msgs = append(msgs, kafka.Message{
+			Topic:     "test-topic",
+			Partition: partition,
+			Offset:    offset,
+			Value:     []byte("value"),
+			Headers:   []kafka.Header{{Key: "version", Value: []byte("2")}},
+		})
+	}
+
+	return msgs
+}
+
+// runUntil runs the consumer until cond is true
+func runUntil(t *testing.T, c *Consumer, cond func() bool) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Run(ctx) }()
+
+	require.Eventually(t, cond, time.Second, time.Millisecond)
+	cancel()
+
+	return <-errCh
+}
+
+func TestNewConsumer(t *testing.T) {
+	handler := func(context.Context, *Message) error { return nil }
+
+	_, err := NewConsumer(nil, handler)
+	assert.Error(t, err)
+
+	_, err = NewConsumerWithOptions(handler, WithBootstrapServers("localhost:9092"), WithTopics("t"))
+	assert.ErrorContains(t, err, "group ID cannot be empty")
+
+	_, err = NewConsumerWithOptions(handler, WithBootstrapServers("localhost:9092"), WithGroupID("g"))
+	assert.ErrorContains(t, err, "at least one topic")
+
+	c, err := NewConsumerWithOptions(
+		handler,
+		WithBootstrapServers("localhost:9092"),
+		WithGroupID("g"),
+		WithTopics("t1", "t2"),
+		WithSASL("user", "pass"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.config.Concurrency)
+	assert.NoError(t, c.Close())
+
+	c, err = NewConsumerWithOptions(
+		handler,
+		WithBootstrapServers("localhost:9092"),
+		WithGroupID("g"),
+		WithTopics("t1"),
+		WithRetryTopic("t1-retry-1", time.Second),
+		WithRetryTopic("t1-retry-2", time.Minute),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"t1"}, c.reader.(*kafka.Reader).Config().GroupTopics)
+	require.Len(t, c.retryReaders, 2)
+	assert.Equal(t, []string{"t1-retry-2"}, c.retryReaders[1].(*kafka.Reader).Config().GroupTopics)
+	assert.NoError(t, c.Close())
+}
+
+func TestConsumer_Run(t *testing.T) {
+	t.Run("messages are handled and committed in order", func(t *testing.T) {
+		r := newFakeReader(append(testMessages(0, 0, 4), testMessages(1, 0, 2)...)...)
+
+		var (
+			mu      sync.Mutex
+			handled []*Message
+		)
+		c := newConsumer(r, func(_ context.Context, msg *Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled = append(handled, msg)
+
+			return nil
+		}, &Config{})
+
+		err := runUntil(t, c, func() bool {
+			offsets := r.committed()
+
+			return offsets[0] == 4 && offsets[1] == 2
+		})
+		assert.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Len(t, handled, 8)
+		assert.Equal(t, "2", handled[0].Version)
+		assert.Equal(t, "test-topic", handled[0].Topic)
+		assert.Equal(t, int64(0), handled[0].Offset)
+	})
+
+	t.Run("only contiguous offsets are committed", func(t *testing.T) {
+		r := newFakeReader(testMessages(0, 0, 3)...)
+		release := make(chan struct{})
+
+		c := newConsumer(r, func(_ context.Context, msg *Message) error {
+			// The first message finishes last.
+			if msg.Offset == 0 {
+				<-release
+			}
+
+			return nil
+		}, &Config{Concurrency: 4})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := make(chan error, 1)
+		go func() { errCh <- c.Run(ctx) }()
+
+		time.Sleep(50 * time.Millisecond)
+		assert.Empty(t, r.committed())
+
+		close(release)
+		require.Eventually(t, func() bool { return r.committed()[0] == 3 }, time.Second, time.Millisecond)
+		cancel()
+		assert.NoError(t, <-errCh)
+	})
+
+	t.Run("blocked partition does not delay the other partitions", func(t *testing.T) {
+		// Partition 0 is fetched first and its first message blocks.
+		r := newFakeReader(append(testMessages(0, 0, 3), testMessages(1, 0, 3)...)...)
+		release := make(chan struct{})
+
+		c := newConsumer(r, func(_ context.Context, msg *Message) error {
+			if msg.Partition == 0 && msg.Offset == 0 {
+				<-release
+			}
+
+			return nil
+		}, &Config{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := make(chan error, 1)
+		go func() { errCh <- c.Run(ctx) }()
+
+		require.Eventually(t, func() bool { return r.committed()[1] == 3 }, time.Second, time.Millisecond)
+		_, ok := r.committed()[0]
+		assert.False(t, ok)
+
+		close(release)
+		require.Eventually(t, func() bool { return r.committed()[0] == 3 }, time.Second, time.Millisecond)
+		cancel()
+		assert.NoError(t, <-errCh)
+	})
+
+	t.Run("failed message stops the consumer without commit", func(t *testing.T) {
+		r := newFakeReader(testMessages(0, 0, 3)...)
+		errHandler := errors.New("handler failed")
+
+		var (
+			mu       sync.Mutex
+			attempts int
+		)
+		c := newConsumer(r, func(_ context.Context, msg *Message) error {
+			if msg.Offset != 2 {
+				return nil
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			attempts++
+
+			return errHandler
+		}, &Config{MaxRetries: 2, RetryBackoff: time.Millisecond})
+
+		err := c.Run(context.Background())
+		assert.ErrorIs(t, err, errHandler)
+		assert.Equal(t, 3, attempts)
+		assert.Equal(t, int64(1), r.committed()[0])
+	})
+
+	t.Run("shutdown waits for the messages being handled", func(t *testing.T) {
+		r := newFakeReader(testMessages(0, 0, 0)...)
+		started := make(chan struct{})
+
+		c := newConsumer(r, func(ctx context.Context, _ *Message) error {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+
+			return ctx.Err()
+		}, &Config{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := make(chan error, 1)
+		go func() { errCh <- c.Run(ctx) }()
+
+		<-started
+		cancel()
+		assert.NoError(t, <-errCh)
+		offset, ok := r.committed()[0]
+		assert.True(t, ok)
+		assert.Equal(t, int64(0), offset)
+	})
+}
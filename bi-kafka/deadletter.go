@@ -0,0 +1,226 @@
+package bikafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers added to the messages sent to the retry and dead letter topics
+const (
+	HeaderOriginalTopic     = "original-topic"
+	HeaderOriginalPartition = "original-partition"
+	HeaderOriginalOffset    = "original-offset"
+	HeaderFailureReason     = "failure-reason"
+	HeaderFailedAt          = "failed-at"
+	HeaderRetryAttempt      = "retry-attempt"
+)
+
+// ErrDeadLettered is returned, wrapping the produce error, when a message could not
+// be produced but was persisted by the dead letter policy
+var ErrDeadLettered = errors.New("message dead lettered")
+
+// RetryTopic is a tier of the consumer retries, the failed messages are handled
+// again after Delay
+type RetryTopic struct {
+	Topic string
+	Delay time.Duration
+}
+
+// messageWriter is the part of kafka.Writer used to forward the failed messages
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// deadLetterQueue persists the messages which could not be produced
+type deadLetterQueue interface {
+	deadLetter(ctx context.Context, msgs []kafka.Message, cause error) error
+}
+
+// topicDeadLetter sends the failed messages to a dead letter topic
+type topicDeadLetter struct {
+	w     messageWriter
+	topic string
+}
+
+func (q *topicDeadLetter) deadLetter(ctx context.Context, msgs []kafka.Message, cause error) error {
+	dead := make([]kafka.Message, len(msgs))
+	for i, m := range msgs {
+		dead[i] = kafka.Message{
+			Topic:   q.topic,
+			Key:     m.Key,
+			Value:   m.Value,
+			Headers: failureHeaders(m, cause, false),
+			Time:    m.Time,
+		}
+	}
+
+	return q.w.WriteMessages(ctx, dead...)
+}
+
+// fileDeadLetter appends the failed messages to a local file, one JSON object per line
+type fileDeadLetter struct {
+	path string
+	mtx  sync.Mutex
+}
+
+// DeadLetterRecord is a line of the dead letter file
+type DeadLetterRecord struct {
+	Topic     string            `json:"topic"`
+	Key       []byte            `json:"key,omitempty"`
+	Value     []byte            `json:"value,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Timestamp time.Time         `json:"timestamp,omitempty"`
+	Reason    string            `json:"reason"`
+	FailedAt  time.Time         `json:"failedAt"`
+}
+
+func (q *fileDeadLetter) deadLetter(_ context.Context, msgs []kafka.Message, cause error) error {
+	var buf []byte
+	now := time.Now().UTC()
+	for _, m := range msgs {
+		rec := DeadLetterRecord{
+			Topic:     m.Topic,
+			Key:       m.Key,
+			Value:     m.Value,
+			Timestamp: m.Time,
+			Reason:    cause.Error(),
+			FailedAt:  now,
+		}
+		if len(m.Headers) > 0 {
+			rec.Headers = make(map[string]string, len(m.Headers))
+			for _, h := range m.Headers {
+				rec.Headers[h.Key] = string(h.Value)
+			}
+		}
+
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	f, err := os.OpenFile(q.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(buf); err != nil {
+		_ = f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
+
+// ReadDeadLetterFile reads the records of a dead letter file, e.g. to produce them again
+func ReadDeadLetterFile(path string) ([]DeadLetterRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []DeadLetterRecord
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var rec DeadLetterRecord
+		if err := dec.Decode(&rec); err != nil {
+			return nil, fmt.Errorf("failed to read dead letter file: %w", err)
+		}
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+// deadLetter persists the failed messages with the first dead letter queue which
+// succeeds. The returned error wraps ErrDeadLettered if the messages are persisted.
+func (p *Producer) deadLetter(ctx context.Context, msgs []kafka.Message, cause error) error {
+	if len(p.deadLetters) == 0 {
+		return cause
+	}
+
+	errs := []error{cause}
+	for _, q := range p.deadLetters {
+		err := q.deadLetter(ctx, msgs, cause)
+		if err == nil {
+			return fmt.Errorf("%w: %w", ErrDeadLettered, cause)
+		}
+		errs = append(errs, fmt.Errorf("failed to dead letter: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// failureHeaders returns the headers of m with the failure headers. The original topic,
+// partition and offset are kept if m has already been forwarded.
+func failureHeaders(m kafka.Message, cause error, consumed bool) []kafka.Header {
+	origin := map[string]string{HeaderOriginalTopic: m.Topic}
+	if consumed {
+		origin[HeaderOriginalPartition] = strconv.Itoa(m.Partition)
+		origin[HeaderOriginalOffset] = strconv.FormatInt(m.Offset, 10)
+	}
+
+	headers := make([]kafka.Header, 0, len(m.Headers)+5)
+	for _, h := range m.Headers {
+		switch h.Key {
+		case HeaderOriginalTopic, HeaderOriginalPartition, HeaderOriginalOffset:
+			origin[h.Key] = string(h.Value)
+		case HeaderFailureReason, HeaderFailedAt, HeaderRetryAttempt:
+		default:
+			headers = append(headers, h)
+		}
+	}
+	for _, key := range []string{HeaderOriginalTopic, HeaderOriginalPartition, HeaderOriginalOffset} {
+		if v, ok := origin[key]; ok {
+			headers = append(headers, kafka.Header{Key: key, Value: []byte(v)})
+		}
+	}
+
+	return append(headers,
+		kafka.Header{Key: HeaderFailureReason, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+	)
+}
+
+// headerValue returns the value of the last header with the key
+func headerValue(headers []kafka.Header, key string) (string, bool) {
+	for i := len(headers) - 1; i >= 0; i-- {
+		if headers[i].Key == key {
+			return string(headers[i].Value), true
+		}
+	}
+
+	return "", false
+}
+
+// failedMessages returns the messages of a batch which failed, the writer reports the
+// errors of each message with kafka.WriteErrors
+func failedMessages(msgs []kafka.Message, err error) []kafka.Message {
+	var werr kafka.WriteErrors
+	if !errors.As(err, &werr) || len(werr) != len(msgs) {
+		return msgs
+	}
+
+	failed := make([]kafka.Message, 0, werr.Count())
+	for i, e := range werr {
+		if e != nil {
+			failed = append(failed, msgs[i])
+		}
+	}
+
+	return failed
+}
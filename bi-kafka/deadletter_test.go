@@ -0,0 +1,266 @@
+package bikafka
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unreachableProducer creates a producer whose writes fail immediately
+func unreachableProducer(t *testing.T, options ...Option) *Producer {
+	p, err := NewProducerWithOptions(append([]Option{WithBootstrapServers("127.0.0.1:1")}, options...)...)
+	require.NoError(t, err)
+	p.writer.MaxAttempts = 1
+	if p.dlqWriter != nil {
+		p.dlqWriter.MaxAttempts = 1
+	}
+	t.Cleanup(func() { _ = p.Close() })
+
+	return p
+}
+
+func header(t *testing.T, headers []kafka.Header, key string) string {
+	v, ok := headerValue(headers, key)
+	require.True(t, ok, "missing header %s", key)
+
+	return v
+}
+
+func TestProducer_DeadLetter(t *testing.T) {
+	t.Run("without a policy the error is returned", func(t *testing.T) {
+		p := unreachableProducer(t)
+
+		err := p.Produce(context.Background(), &Message{Topic: "orders", Value: []byte("v")})
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrDeadLettered)
+	})
+
+	t.Run("dead letter topic", func(t *testing.T) {
+		p := unreachableProducer(t)
+		dlq := NewMockWriter()
+		p.deadLetters = []deadLetterQueue{&topicDeadLetter{w: dlq, topic: "orders.dlq"}}
+
+		err := p.ProduceBatch(context.Background(), []*Message{
+			{Topic: "orders", Key: []byte("k1"), Value: []byte("v1"), Version: "1"},
+			{Topic: "orders", Key: []byte("k2"), Value: []byte("v2"), Version: "1"},
+		})
+		assert.ErrorIs(t, err, ErrDeadLettered)
+
+		msgs := dlq.GetMessages()
+		require.Len(t, msgs, 2)
+		assert.Equal(t, "orders.dlq", msgs[0].Topic)
+		assert.Equal(t, []byte("k2"), msgs[1].Key)
+		assert.Equal(t, "1", header(t, msgs[0].Headers, version))
+		assert.Equal(t, "orders", header(t, msgs[0].Headers, HeaderOriginalTopic))
+		assert.Contains(t, header(t, msgs[0].Headers, HeaderFailureReason), "failed to send batch messages")
+	})
+
+	t.Run("dead letter file is the fallback of the topic", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dlq.jsonl")
+		p := unreachableProducer(t, WithDeadLetterTopic("orders.dlq"), WithDeadLetterFile(path))
+		require.Len(t, p.deadLetters, 2)
+
+		err := p.Produce(context.Background(), &Message{Topic: "orders", Key: []byte("k"), Value: []byte("v"), Version: "2"})
+		assert.ErrorIs(t, err, ErrDeadLettered)
+
+		records, err := ReadDeadLetterFile(path)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		assert.Equal(t, "orders", records[0].Topic)
+		assert.Equal(t, []byte("v"), records[0].Value)
+		assert.Equal(t, "2", records[0].Headers[version])
+		assert.Contains(t, records[0].Reason, "failed to send message to topic orders")
+	})
+
+	t.Run("only the failed messages of a batch are dead lettered", func(t *testing.T) {
+		msgs := []kafka.Message{{Offset: 0}, {Offset: 1}, {Offset: 2}}
+		werr := kafka.WriteErrors{nil, errors.New("failed"), nil}
+
+		assert.Equal(t, []kafka.Message{{Offset: 1}}, failedMessages(msgs, werr))
+		assert.Equal(t, msgs, failedMessages(msgs, errors.New("failed")))
+	})
+}
+
+// loopbackWriter writes the messages of the retry topics back to their readers, as
+// if the consumer is subscribed to them
+type loopbackWriter struct {
+	readers map[string]*fakeReader
+	mu      sync.Mutex
+	written []kafka.Message
+}
+
+func (w *loopbackWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, m := range msgs {
+		m.Offset = int64(len(w.written))
+		w.written = append(w.written, m)
+		if r, ok := w.readers[m.Topic]; ok {
+			r.messages <- m
+		}
+	}
+
+	return nil
+}
+
+func (w *loopbackWriter) Close() error { return nil }
+
+func (w *loopbackWriter) topic(topic string) []kafka.Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var msgs []kafka.Message
+	for _, m := range w.written {
+		if m.Topic == topic {
+			msgs = append(msgs, m)
+		}
+	}
+
+	return msgs
+}
+
+func TestConsumer_RetryTopics(t *testing.T) {
+	config := &Config{
+		RetryTopics:     []RetryTopic{{Topic: "retry-1"}, {Topic: "retry-2", Delay: 50 * time.Millisecond}},
+		DeadLetterTopic: "dlq",
+	}
+
+	t.Run("failed messages go through the retry topics to the dead letter topic", func(t *testing.T) {
+		r := newFakeReader(testMessages(0, 7, 7)...)
+		retry1 := &fakeReader{messages: make(chan kafka.Message, 1)}
+		retry2 := &fakeReader{messages: make(chan kafka.Message, 1)}
+		w := &loopbackWriter{readers: map[string]*fakeReader{"retry-1": retry1, "retry-2": retry2}}
+
+		var (
+			mu     sync.Mutex
+			topics []string
+		)
+		c := newConsumer(r, func(_ context.Context, msg *Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			topics = append(topics, msg.Topic)
+
+			return errors.New("handler failed")
+		}, config)
+		c.retryReaders = []reader{retry1, retry2}
+		c.writer = w
+
+		err := runUntil(t, c, func() bool { return len(w.topic("dlq")) == 1 })
+		assert.NoError(t, err)
+
+		mu.Lock()
+		assert.Equal(t, []string{"test-topic", "test-topic", "test-topic"}, topics)
+		mu.Unlock()
+
+		retried := w.topic("retry-2")
+		require.Len(t, retried, 1)
+		assert.Equal(t, "2", header(t, retried[0].Headers, HeaderRetryAttempt))
+
+		dead := w.topic("dlq")[0]
+		assert.Equal(t, []byte("value"), dead.Value)
+		assert.Equal(t, "2", header(t, dead.Headers, version))
+		assert.Equal(t, "test-topic", header(t, dead.Headers, HeaderOriginalTopic))
+		assert.Equal(t, "7", header(t, dead.Headers, HeaderOriginalOffset))
+		assert.Contains(t, header(t, dead.Headers, HeaderFailureReason), "retry-2/0/1: handler failed")
+		_, ok := headerValue(dead.Headers, HeaderRetryAttempt)
+		assert.False(t, ok)
+
+		// The forwarded messages are committed by their readers.
+		for _, r := range []*fakeReader{r, retry1, retry2} {
+			assert.Len(t, r.committed(), 1)
+		}
+	})
+
+	t.Run("retried messages are handled after the delay", func(t *testing.T) {
+		r := &fakeReader{messages: make(chan kafka.Message, 1)}
+		r.messages <- kafka.Message{
+			Topic: "retry-2",
+			Value: []byte("value"),
+			Time:  time.Now(),
+			Headers: []kafka.Header{
+				{Key: HeaderOriginalTopic, Value: []byte("test-topic")},
+				{Key: HeaderRetryAttempt, Value: []byte("2")},
+			},
+		}
+
+		var handledAt time.Time
+		start := time.Now()
+		c := newConsumer(r, func(_ context.Context, msg *Message) error {
+			assert.Equal(t, "test-topic", msg.Topic)
+			handledAt = time.Now()
+
+			return nil
+		}, config)
+		c.writer = NewMockWriter()
+
+		err := runUntil(t, c, func() bool { return len(r.committed()) == 1 })
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, handledAt.Sub(start), 50*time.Millisecond)
+	})
+
+	t.Run("delayed retries do not hold back the main topic", func(t *testing.T) {
+		// The retry partition queue is full while its messages wait for the delay.
+		config := &Config{
+			RetryTopics:        []RetryTopic{{Topic: "retry-1", Delay: 200 * time.Millisecond}},
+			PartitionQueueSize: 1,
+		}
+		var retries []kafka.Message
+		for offset := range int64(3) {
+			retries = append(retries, kafka.Message{
+				Topic:   "retry-1",
+				Offset:  offset,
+				Value:   []byte("value"),
+				Time:    time.Now(),
+				Headers: []kafka.Header{{Key: HeaderOriginalTopic, Value: []byte("test-topic")}},
+			})
+		}
+		retry := newFakeReader(retries...)
+		r := &fakeReader{messages: make(chan kafka.Message, 8)}
+
+		var (
+			mu      sync.Mutex
+			retried time.Time
+		)
+		c := newConsumer(r, func(_ context.Context, msg *Message) error {
+			if _, ok := headerValue(msg.Headers, HeaderOriginalTopic); ok {
+				mu.Lock()
+				if retried.IsZero() {
+					retried = time.Now()
+				}
+				mu.Unlock()
+			}
+
+			return nil
+		}, config)
+		c.retryReaders = []reader{retry}
+		c.writer = NewMockWriter()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := make(chan error, 1)
+		go func() { errCh <- c.Run(ctx) }()
+
+		// The main topic traffic arrives while the retry waits for its delay.
+		start := time.Now()
+		time.Sleep(20 * time.Millisecond)
+		for _, m := range testMessages(0, 0, 4) {
+			r.messages <- m
+		}
+		require.Eventually(t, func() bool { return r.committed()[0] == 4 }, 100*time.Millisecond, time.Millisecond)
+		assert.Empty(t, retry.committed())
+
+		require.Eventually(t, func() bool { return retry.committed()[0] == 2 }, time.Second, time.Millisecond)
+		cancel()
+		assert.NoError(t, <-errCh)
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.GreaterOrEqual(t, retried.Sub(start), 200*time.Millisecond)
+	})
+}
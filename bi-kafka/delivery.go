@@ -0,0 +1,216 @@
+package bikafka
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	qmetrics "github.com/clubpay/qlubkit-go/telemetry/metrics"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const attrDestination = "messaging.destination.name"
+
+// Delivery is the delivery report of a produced message, Partition and Offset are set
+// if Err is nil
+type Delivery struct {
+	Message   *Message
+	Topic     string
+	Partition int
+	Offset    int64
+	Err       error
+}
+
+// deliveryGroup is the channel of the delivery reports of an async call, it is closed
+// after all the messages are reported
+type deliveryGroup struct {
+	ch        chan Delivery
+	remaining atomic.Int64
+}
+
+// deliveryRef is passed to the writer with the message, so its report is sent to the
+// group of the call. A message is reported once.
+type deliveryRef struct {
+	group    *deliveryGroup
+	msg      *Message
+	reported atomic.Bool
+}
+
+type producerMetrics struct {
+	delivered metric.Int64Counter
+	failed    metric.Int64Counter
+}
+
+func newProducerMetrics(meter metric.Meter) *producerMetrics {
+	m := &producerMetrics{}
+	// the names are constant and valid, so creating the instruments cannot fail.
+	m.delivered, _ = meter.Int64Counter(
+		qmetrics.QlubKafkaDeliveredCnt,
+		metric.WithDescription("number of the messages delivered to kafka"),
+	)
+	m.failed, _ = meter.Int64Counter(
+		qmetrics.QlubKafkaDeliveryErrorCnt,
+		metric.WithDescription("number of the messages which could not be delivered to kafka"),
+	)
+
+	return m
+}
+
+// ProduceAsync sends a message without waiting for the broker. The delivery report is
+// sent to the returned channel, which is closed after it.
+func (p *Producer) ProduceAsync(ctx context.Context, msg *Message) <-chan Delivery {
+	return p.ProduceBatchAsync(ctx, []*Message{msg})
+}
+
+// ProduceBatchAsync sends multiple messages without waiting for the broker. The
+// delivery report of each message is sent to the returned channel, which is closed
+// after all of them. Unless the producer is async, ctx bounds the write. The failed
+// messages are dead lettered before they are reported, their error wraps
+// ErrDeadLettered if it succeeds.
+func (p *Producer) ProduceBatchAsync(ctx context.Context, messages []*Message) <-chan Delivery {
+	g := &deliveryGroup{ch: make(chan Delivery, len(messages))}
+	g.remaining.Store(int64(len(messages)))
+	if len(messages) == 0 {
+		close(g.ch)
+
+		return g.ch
+	}
+
+	ctx, span := p.startPublish(ctx, messages)
+	kafkaMessages, err := kafkaMessages(messages)
+	if err != nil {
+		endSpan(span, err)
+		for _, msg := range messages {
+			d := Delivery{Message: msg, Err: err}
+			if msg != nil {
+				d.Topic = msg.Topic
+			}
+			g.ch <- d
+		}
+		close(g.ch)
+
+		return g.ch
+	}
+
+	refs := make([]*deliveryRef, len(messages))
+	for i := range kafkaMessages {
+		refs[i] = &deliveryRef{group: g, msg: messages[i]}
+		kafkaMessages[i].WriterData = refs[i]
+	}
+
+	// In async mode the span ends once the messages are queued.
+	write := func() {
+		err := p.writer.WriteMessages(ctx, kafkaMessages...)
+		endSpan(span, err)
+		if err == nil {
+			return
+		}
+		// The messages which did not reach the completion are reported here.
+		for i, ref := range refs {
+			if !ref.reported.CompareAndSwap(false, true) {
+				continue
+			}
+			cause := fmt.Errorf("failed to send message to topic %s: %w", ref.msg.Topic, err)
+			p.report(ctx, ref, Delivery{
+				Message: ref.msg,
+				Topic:   ref.msg.Topic,
+				Err:     p.deadLetter(ctx, kafkaMessages[i:i+1], cause),
+			})
+		}
+	}
+	if p.config.Async {
+		write()
+	} else {
+		go write()
+	}
+
+	return g.ch
+}
+
+// complete is the completion function of the writer, it is called with the messages
+// written to a partition. The failed messages of the calls which do not see the
+// error, i.e. async calls or any call of an async producer, are dead lettered in the
+// background before they are reported.
+func (p *Producer) complete(messages []kafka.Message, err error) {
+	var (
+		dead     []kafka.Message
+		deadRefs []*deliveryRef
+	)
+	for _, m := range messages {
+		d := Delivery{
+			Topic:     m.Topic,
+			Partition: m.Partition,
+			Offset:    m.Offset,
+		}
+		if err != nil {
+			d.Err = fmt.Errorf("failed to send message to topic %s: %w", m.Topic, err)
+		}
+
+		ref, _ := m.WriterData.(*deliveryRef)
+		if ref != nil {
+			d.Message = ref.msg
+		} else {
+			d.Message = messageFromKafka(m)
+		}
+
+		if ref != nil && !ref.reported.CompareAndSwap(false, true) {
+			continue
+		}
+		if err != nil && len(p.deadLetters) > 0 && (ref != nil || p.config.Async) {
+			dead = append(dead, m)
+			deadRefs = append(deadRefs, ref)
+
+			continue
+		}
+		p.report(context.Background(), ref, d)
+	}
+	if len(dead) == 0 {
+		return
+	}
+
+	// The completion runs on the goroutine of the partition writer, which must not
+	// wait for the dead letter queues.
+	p.pending.Add(1)
+	go func() {
+		defer p.pending.Done()
+
+		ctx := context.Background()
+		cause := fmt.Errorf("failed to send message to topic %s: %w", dead[0].Topic, err)
+		dlErr := p.deadLetter(ctx, dead, cause)
+		for i, m := range dead {
+			d := Delivery{Topic: m.Topic, Err: dlErr}
+			if ref := deadRefs[i]; ref != nil {
+				d.Message = ref.msg
+			} else {
+				d.Message = messageFromKafka(m)
+			}
+			p.report(ctx, deadRefs[i], d)
+		}
+	}()
+}
+
+// report records the delivery and reports it to the callback and the async call of
+// the message, if any. The caller must have marked ref reported, so each message is
+// reported once.
+func (p *Producer) report(ctx context.Context, ref *deliveryRef, d Delivery) {
+	if m := p.metrics; m != nil {
+		attrs := metric.WithAttributes(attribute.String(attrDestination, d.Topic))
+		if d.Err == nil {
+			m.delivered.Add(ctx, 1, attrs)
+		} else {
+			m.failed.Add(ctx, 1, attrs)
+		}
+	}
+	if p.config.OnDelivery != nil {
+		p.config.OnDelivery(d)
+	}
+
+	if ref != nil {
+		ref.group.ch <- d
+		if ref.group.remaining.Add(-1) == 0 {
+			close(ref.group.ch)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package bikafka
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	qmetrics "github.com/clubpay/qlubkit-go/telemetry/metrics"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func collectDeliveries(ch <-chan Delivery) []Delivery {
+	var deliveries []Delivery
+	for d := range ch {
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries
+}
+
+// deliveryCounts returns the delivered and failed counters by topic
+func deliveryCounts(t *testing.T, reader *sdkmetric.ManualReader) map[string]map[string]int64 {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	counts := make(map[string]map[string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+			counts[m.Name] = make(map[string]int64)
+			for _, dp := range sum.DataPoints {
+				topic, _ := dp.Attributes.Value(attrDestination)
+				counts[m.Name][topic.AsString()] += dp.Value
+			}
+		}
+	}
+
+	return counts
+}
+
+func TestProducer_ProduceAsync(t *testing.T) {
+	t.Run("invalid messages are reported", func(t *testing.T) {
+		p := unreachableProducer(t)
+
+		deliveries := collectDeliveries(p.ProduceBatchAsync(context.Background(), []*Message{{Topic: "orders"}, nil}))
+		require.Len(t, deliveries, 2)
+		assert.ErrorContains(t, deliveries[0].Err, "message at index 1 is nil")
+		assert.Equal(t, "orders", deliveries[0].Topic)
+		assert.Nil(t, deliveries[1].Message)
+
+		assert.Empty(t, collectDeliveries(p.ProduceBatchAsync(context.Background(), nil)))
+	})
+
+	t.Run("failed deliveries are reported", func(t *testing.T) {
+		reader := sdkmetric.NewManualReader()
+		var (
+			mu        sync.Mutex
+			callbacks []Delivery
+		)
+		p := unreachableProducer(t,
+			WithMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("bikafka")),
+			WithDeliveryCallback(func(d Delivery) {
+				mu.Lock()
+				defer mu.Unlock()
+				callbacks = append(callbacks, d)
+			}),
+		)
+
+		msgs := []*Message{{Topic: "orders", Key: []byte("o1")}, {Topic: "orders", Key: []byte("o2")}}
+		deliveries := collectDeliveries(p.ProduceBatchAsync(context.Background(), msgs))
+		require.Len(t, deliveries, 2)
+		for _, d := range deliveries {
+			assert.ErrorContains(t, d.Err, "failed to send message to topic orders")
+			assert.Contains(t, msgs, d.Message)
+		}
+
+		mu.Lock()
+		assert.Len(t, callbacks, 2)
+		mu.Unlock()
+		assert.Equal(t, int64(2), deliveryCounts(t, reader)[qmetrics.QlubKafkaDeliveryErrorCnt]["orders"])
+	})
+
+	t.Run("completions are reported with partition and offset", func(t *testing.T) {
+		reader := sdkmetric.NewManualReader()
+		var callbacks []Delivery
+		p := unreachableProducer(t,
+			WithMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("bikafka")),
+			WithDeliveryCallback(func(d Delivery) { callbacks = append(callbacks, d) }),
+		)
+
+		g := &deliveryGroup{ch: make(chan Delivery, 2)}
+		g.remaining.Store(2)
+		msg := &Message{Topic: "orders"}
+		ref := &deliveryRef{group: g, msg: msg}
+
+		// The writer calls the completion once per partition.
+		p.complete([]kafka.Message{{Topic: "orders", Partition: 3, Offset: 10, WriterData: ref}}, nil)
+		p.complete([]kafka.Message{{Topic: "orders", Partition: 3, Offset: 10, WriterData: ref}}, nil)
+		p.complete([]kafka.Message{{Topic: "payments", Partition: 1, Offset: 7}}, nil)
+		p.complete([]kafka.Message{{Topic: "orders", WriterData: &deliveryRef{group: g, msg: msg}}}, assert.AnError)
+
+		deliveries := collectDeliveries(g.ch)
+		require.Len(t, deliveries, 2)
+		assert.Equal(t, Delivery{Message: msg, Topic: "orders", Partition: 3, Offset: 10}, deliveries[0])
+		assert.ErrorIs(t, deliveries[1].Err, assert.AnError)
+
+		require.Len(t, callbacks, 3)
+		assert.Equal(t, "payments", callbacks[1].Message.Topic)
+		assert.Equal(t, int64(7), callbacks[1].Offset)
+
+		counts := deliveryCounts(t, reader)
+		assert.Equal(t, map[string]int64{"orders": 1, "payments": 1}, counts[qmetrics.QlubKafkaDeliveredCnt])
+		assert.Equal(t, map[string]int64{"orders": 1}, counts[qmetrics.QlubKafkaDeliveryErrorCnt])
+	})
+
+	t.Run("failed async deliveries are dead lettered", func(t *testing.T) {
+		reader := sdkmetric.NewManualReader()
+		var (
+			mu        sync.Mutex
+			callbacks []Delivery
+		)
+		p := unreachableProducer(t,
+			WithDeadLetterTopic("orders.dlq"),
+			WithMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("bikafka")),
+			WithDeliveryCallback(func(d Delivery) {
+				mu.Lock()
+				defer mu.Unlock()
+				callbacks = append(callbacks, d)
+			}),
+		)
+		dlq := NewMockWriter()
+		p.deadLetters = []deadLetterQueue{&topicDeadLetter{w: dlq, topic: "orders.dlq"}}
+
+		msgs := []*Message{{Topic: "orders", Key: []byte("o1")}, {Topic: "orders", Key: []byte("o2")}}
+		deliveries := collectDeliveries(p.ProduceBatchAsync(context.Background(), msgs))
+		require.Len(t, deliveries, 2)
+		for _, d := range deliveries {
+			assert.ErrorIs(t, d.Err, ErrDeadLettered)
+			assert.ErrorContains(t, d.Err, "failed to send message to topic orders")
+		}
+		require.Len(t, dlq.GetMessages(), 2)
+		assert.Equal(t, "orders.dlq", dlq.GetMessages()[0].Topic)
+
+		// The dead letter writes are neither reported nor counted as delivered.
+		mu.Lock()
+		assert.Len(t, callbacks, 2)
+		mu.Unlock()
+		counts := deliveryCounts(t, reader)
+		assert.Empty(t, counts[qmetrics.QlubKafkaDeliveredCnt])
+		assert.Equal(t, map[string]int64{"orders": 2}, counts[qmetrics.QlubKafkaDeliveryErrorCnt])
+	})
+
+	t.Run("failed messages of an async producer are dead lettered", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dlq.jsonl")
+		var (
+			mu        sync.Mutex
+			callbacks []Delivery
+		)
+		p := unreachableProducer(t,
+			WithAsync(),
+			WithDeadLetterFile(path),
+			WithDeliveryCallback(func(d Delivery) {
+				mu.Lock()
+				defer mu.Unlock()
+				callbacks = append(callbacks, d)
+			}),
+		)
+
+		// The writes of an async producer return before the broker fails them, the
+		// error is only seen by the completion.
+		p.complete([]kafka.Message{{Topic: "orders", Key: []byte("o1"), Value: []byte("v")}}, assert.AnError)
+		require.NoError(t, p.Close())
+
+		records, err := ReadDeadLetterFile(path)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		assert.Equal(t, "orders", records[0].Topic)
+		assert.Equal(t, []byte("o1"), records[0].Key)
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Len(t, callbacks, 1)
+		assert.ErrorIs(t, callbacks[0].Err, ErrDeadLettered)
+	})
+
+	t.Run("the dead letter topic has its own writer", func(t *testing.T) {
+		p := unreachableProducer(t, WithDeadLetterTopic("orders.dlq"))
+		require.NotNil(t, p.dlqWriter)
+		assert.NotSame(t, p.writer, p.dlqWriter)
+		assert.Nil(t, p.dlqWriter.Completion)
+		assert.Same(t, p.dlqWriter, p.deadLetters[0].(*topicDeadLetter).w)
+	})
+}
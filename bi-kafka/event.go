@@ -0,0 +1,261 @@
+package bikafka
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const contentType = "content-type"
+
+var (
+	ErrUnknownEvent      = errors.New("event is not registered")
+	ErrEventTypeMismatch = errors.New("event type does not match")
+)
+
+// Validator is implemented by the event types which validate themselves before
+// they are produced
+type Validator interface {
+	Validate() error
+}
+
+// Registry keeps the Go types of the events per topic and version, so the events
+// are marshaled and validated on produce and decoded to the right type on consume
+type Registry struct {
+	mu       sync.RWMutex
+	codec    Codec
+	codecs   map[string]Codec
+	events   map[eventKey]*eventType
+	versions map[typeKey]string
+}
+
+type eventKey struct {
+	topic   string
+	version string
+}
+
+type typeKey struct {
+	topic string
+	typ   reflect.Type
+}
+
+type eventType struct {
+	typ     reflect.Type
+	codec   Codec
+	upgrade func(v any) (string, any, error)
+}
+
+// EventOption configures a registered event
+type EventOption func(*eventType)
+
+// WithEventCodec sets the codec of the event, overriding the codec of the registry
+func WithEventCodec(codec Codec) EventOption {
+	return func(e *eventType) {
+		e.codec = codec
+	}
+}
+
+// NewRegistry creates a registry whose events are marshaled with codec, JSON if nil
+func NewRegistry(codec Codec) *Registry {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+
+	r := &Registry{
+		codec:    codec,
+		codecs:   make(map[string]Codec),
+		events:   make(map[eventKey]*eventType),
+		versions: make(map[typeKey]string),
+	}
+	for _, c := range []Codec{JSONCodec{}, ProtoCodec{}, AvroCodec{}, codec} {
+		r.codecs[c.ContentType()] = c
+	}
+
+	return r
+}
+
+// Register registers T as the type of the events of the topic with the version
+func Register[T any](r *Registry, topic, version string, options ...EventOption) {
+	e := &eventType{
+		typ:   reflect.TypeFor[T](),
+		codec: r.codec,
+	}
+	for _, option := range options {
+		option(e)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events[eventKey{topic: topic, version: version}] = e
+	r.versions[typeKey{topic: topic, typ: e.typ}] = version
+	r.codecs[e.codec.ContentType()] = e.codec
+}
+
+// RegisterUpgrade registers fn to upgrade the events of the topic from one version
+// to another when they are decoded. Both versions must be registered with the types
+// of fn. Upgrades are chained, so an event is upgraded until its version has no upgrade.
+func RegisterUpgrade[From, To any](r *Registry, topic, from, to string, fn func(From) (To, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.events[eventKey{topic: topic, version: from}]
+	if !ok {
+		return fmt.Errorf("%w: %s version %s", ErrUnknownEvent, topic, from)
+	}
+	if e.typ != reflect.TypeFor[From]() {
+		return fmt.Errorf("%w: %s version %s is %s", ErrEventTypeMismatch, topic, from, e.typ)
+	}
+	toEvent, ok := r.events[eventKey{topic: topic, version: to}]
+	if !ok {
+		return fmt.Errorf("%w: %s version %s", ErrUnknownEvent, topic, to)
+	}
+	if toEvent.typ != reflect.TypeFor[To]() {
+		return fmt.Errorf("%w: %s version %s is %s", ErrEventTypeMismatch, topic, to, toEvent.typ)
+	}
+
+	e.upgrade = func(v any) (string, any, error) {
+		event, ok := v.(From)
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %s version %s is %T", ErrEventTypeMismatch, topic, from, v)
+		}
+		upgraded, err := fn(event)
+
+		return to, upgraded, err
+	}
+
+	return nil
+}
+
+// NewMessage validates and marshals the event into a message of the topic, the
+// version is the one registered for the type of the event
+func (r *Registry) NewMessage(topic string, key []byte, event any) (*Message, error) {
+	typ := reflect.TypeOf(event)
+
+	r.mu.RLock()
+	version, ok := r.versions[typeKey{topic: topic, typ: typ}]
+	e := r.events[eventKey{topic: topic, version: version}]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s for topic %s", ErrUnknownEvent, typ, topic)
+	}
+
+	if err := validate(event); err != nil {
+		return nil, fmt.Errorf("invalid event: %w", err)
+	}
+
+	value, err := e.codec.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	return &Message{
+		Topic: topic,
+		Key:   key,
+		Value: value,
+		Headers: []kafka.Header{{
+			Key:   contentType,
+			Value: []byte(e.codec.ContentType()),
+		}},
+		Version: version,
+	}, nil
+}
+
+// Decode decodes the message to the type registered for its topic and version, and
+// upgrades it through the registered upgrades. It returns the decoded event and its
+// version after the upgrades.
+func (r *Registry) Decode(msg *Message) (any, string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.events[eventKey{topic: msg.Topic, version: msg.Version}]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: %s version %s", ErrUnknownEvent, msg.Topic, msg.Version)
+	}
+
+	codec := e.codec
+	for _, h := range msg.Headers {
+		if h.Key == contentType {
+			if c, ok := r.codecs[string(h.Value)]; ok {
+				codec = c
+			}
+		}
+	}
+
+	event, err := e.decode(codec, msg.Value)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode event: %w", err)
+	}
+
+	// The number of upgrades is bounded, so a cycle of upgrades cannot loop forever.
+	version := msg.Version
+	for range len(r.events) {
+		if e.upgrade == nil {
+			break
+		}
+		if version, event, err = e.upgrade(event); err != nil {
+			return nil, "", fmt.Errorf("failed to upgrade event: %w", err)
+		}
+		if e, ok = r.events[eventKey{topic: msg.Topic, version: version}]; !ok {
+			break
+		}
+	}
+
+	return event, version, nil
+}
+
+// validate validates the event if it, or a pointer to it, is a Validator
+func validate(event any) error {
+	if v, ok := event.(Validator); ok {
+		return v.Validate()
+	}
+
+	ptr := reflect.New(reflect.TypeOf(event))
+	ptr.Elem().Set(reflect.ValueOf(event))
+	if v, ok := ptr.Interface().(Validator); ok {
+		return v.Validate()
+	}
+
+	return nil
+}
+
+// decode unmarshals data into a new value of the type. Pointer types, such as proto
+// messages, are unmarshaled into a new element.
+func (e *eventType) decode(codec Codec, data []byte) (any, error) {
+	if e.typ.Kind() == reflect.Pointer {
+		ptr := reflect.New(e.typ.Elem())
+		if err := codec.Unmarshal(data, ptr.Interface()); err != nil {
+			return nil, err
+		}
+
+		return ptr.Interface(), nil
+	}
+
+	ptr := reflect.New(e.typ)
+	if err := codec.Unmarshal(data, ptr.Interface()); err != nil {
+		return nil, err
+	}
+
+	return ptr.Elem().Interface(), nil
+}
+
+// Decode decodes the message by the registry and returns the event as T
+func Decode[T any](r *Registry, msg *Message) (T, error) {
+	var zero T
+
+	event, version, err := r.Decode(msg)
+	if err != nil {
+		return zero, err
+	}
+
+	t, ok := event.(T)
+	if !ok {
+		return zero, fmt.Errorf("%w: %s version %s is %T", ErrEventTypeMismatch, msg.Topic, version, event)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,207 @@
+package bikafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type orderCreatedV1 struct {
+	OrderID string
+	Amount  float64
+}
+
+type orderCreatedV2 struct {
+	OrderID  string
+	Amount   int64
+	Currency string
+}
+
+func (e orderCreatedV2) Validate() error {
+	if e.OrderID == "" {
+		return errors.New("order ID is required")
+	}
+
+	return nil
+}
+
+type avroEvent struct {
+	ID        int64
+	Name      string
+	Active    bool
+	Ratio     float32
+	Score     float64
+	Small     int8
+	Count     uint16
+	Raw       []byte
+	Tags      []string
+	Attrs     map[string]int
+	Parent    *avroEvent
+	CreatedAt time.Time
+	Skipped   string `avro:"-"`
+	hidden    string
+}
+
+func TestAvroCodec(t *testing.T) {
+	in := avroEvent{
+		ID:        -42,
+		Name:      "qlub",
+		Active:    true,
+		Ratio:     0.5,
+		Score:     3.25,
+		Small:     -3,
+		Count:     500,
+		Raw:       []byte{0, 1, 2},
+		Tags:      []string{"a", "b"},
+		Attrs:     map[string]int{"x": 1, "y": -2},
+		Parent:    &avroEvent{ID: 1, Tags: []string{}, Attrs: map[string]int{}, CreatedAt: time.UnixMilli(0)},
+		CreatedAt: time.UnixMilli(1700000000123),
+		Skipped:   "skipped",
+		hidden:    "hidden",
+	}
+
+	data, err := AvroCodec{}.Marshal(&in)
+	require.NoError(t, err)
+
+	var out avroEvent
+	require.NoError(t, AvroCodec{}.Unmarshal(data, &out))
+
+	assert.Empty(t, out.Skipped)
+	assert.Empty(t, out.hidden)
+	in.Skipped, in.hidden = "", ""
+	assert.Equal(t, in, out)
+
+	// The encoding follows the Avro spec: zigzag varint longs and length prefixed strings.
+	data, err = AvroCodec{}.Marshal(struct {
+		N int64
+		S string
+	}{N: -1, S: "ab"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x01, 0x04, 'a', 'b'}, data)
+
+	assert.Error(t, AvroCodec{}.Unmarshal([]byte{0x04, 'a'}, &out))
+}
+
+func TestAvroCodec_Malformed(t *testing.T) {
+	data, err := AvroCodec{}.Marshal(&avroEvent{Tags: []string{"a"}, Attrs: map[string]int{"x": 1}})
+	require.NoError(t, err)
+
+	t.Run("truncated", func(t *testing.T) {
+		for i := range len(data) {
+			var out avroEvent
+			assert.Error(t, AvroCodec{}.Unmarshal(data[:i], &out), "length %d", i)
+		}
+	})
+
+	t.Run("oversized lengths", func(t *testing.T) {
+		var s struct{ S string }
+		assert.Error(t, AvroCodec{}.Unmarshal(binary.AppendVarint(nil, math.MaxInt64), &s))
+
+		var tags struct{ Tags []string }
+		assert.Error(t, AvroCodec{}.Unmarshal(binary.AppendVarint(nil, math.MaxInt64), &tags))
+		assert.Error(t, AvroCodec{}.Unmarshal(binary.AppendVarint(nil, math.MinInt64), &tags))
+		assert.Error(t, AvroCodec{}.Unmarshal([]byte{0x06, 0x02, 'a'}, &tags))
+	})
+
+	t.Run("elements without bytes", func(t *testing.T) {
+		var empty struct{ E []struct{} }
+		assert.Error(t, AvroCodec{}.Unmarshal([]byte{0x06, 0x00, 0x00, 0x00}, &empty))
+	})
+}
+
+func FuzzAvroUnmarshal(f *testing.F) {
+	data, err := AvroCodec{}.Marshal(&avroEvent{
+		Name:   "qlub",
+		Raw:    []byte{1},
+		Tags:   []string{"a"},
+		Attrs:  map[string]int{"x": 1},
+		Parent: &avroEvent{ID: 1},
+	})
+	require.NoError(f, err)
+	f.Add(data)
+	f.Add(binary.AppendVarint(nil, math.MaxInt64))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var out avroEvent
+		_ = AvroCodec{}.Unmarshal(data, &out)
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(nil)
+	Register[orderCreatedV1](r, "orders", "1")
+	Register[orderCreatedV2](r, "orders", "2", WithEventCodec(AvroCodec{}))
+	Register[*wrapperspb.StringValue](r, "names", "1", WithEventCodec(ProtoCodec{}))
+	require.NoError(t, RegisterUpgrade(r, "orders", "1", "2", func(e orderCreatedV1) (orderCreatedV2, error) {
+		return orderCreatedV2{OrderID: e.OrderID, Amount: int64(e.Amount * 100), Currency: "AED"}, nil
+	}))
+
+	t.Run("produce and consume the latest version", func(t *testing.T) {
+		msg, err := r.NewMessage("orders", []byte("o1"), orderCreatedV2{OrderID: "o1", Amount: 1250, Currency: "USD"})
+		require.NoError(t, err)
+		assert.Equal(t, "2", msg.Version)
+		assert.Equal(t, "avro/binary", string(msg.Headers[0].Value))
+
+		event, err := Decode[orderCreatedV2](r, msg)
+		require.NoError(t, err)
+		assert.Equal(t, orderCreatedV2{OrderID: "o1", Amount: 1250, Currency: "USD"}, event)
+	})
+
+	t.Run("old versions are upgraded", func(t *testing.T) {
+		msg, err := r.NewMessage("orders", nil, orderCreatedV1{OrderID: "o2", Amount: 12.5})
+		require.NoError(t, err)
+		assert.Equal(t, "1", msg.Version)
+		assert.JSONEq(t, `{"OrderID":"o2","Amount":12.5}`, string(msg.Value))
+
+		event, version, err := r.Decode(msg)
+		require.NoError(t, err)
+		assert.Equal(t, "2", version)
+		assert.Equal(t, orderCreatedV2{OrderID: "o2", Amount: 1250, Currency: "AED"}, event)
+	})
+
+	t.Run("proto events", func(t *testing.T) {
+		msg, err := r.NewMessage("names", nil, wrapperspb.String("qlub"))
+		require.NoError(t, err)
+
+		event, err := Decode[*wrapperspb.StringValue](r, msg)
+		require.NoError(t, err)
+		assert.Equal(t, "qlub", event.GetValue())
+	})
+
+	t.Run("validation and errors", func(t *testing.T) {
+		_, err := r.NewMessage("orders", nil, orderCreatedV2{})
+		assert.ErrorContains(t, err, "order ID is required")
+
+		_, err = r.NewMessage("payments", nil, orderCreatedV2{OrderID: "o1"})
+		assert.ErrorIs(t, err, ErrUnknownEvent)
+
+		_, err = Decode[orderCreatedV2](r, &Message{Topic: "orders", Version: "3"})
+		assert.ErrorIs(t, err, ErrUnknownEvent)
+
+		msg, err := r.NewMessage("orders", nil, orderCreatedV2{OrderID: "o1"})
+		require.NoError(t, err)
+		_, err = Decode[orderCreatedV1](r, msg)
+		assert.ErrorIs(t, err, ErrEventTypeMismatch)
+
+		err = RegisterUpgrade(r, "orders", "2", "3", func(e orderCreatedV1) (orderCreatedV2, error) {
+			return orderCreatedV2{}, nil
+		})
+		assert.ErrorIs(t, err, ErrEventTypeMismatch)
+
+		err = RegisterUpgrade(r, "orders", "1", "3", func(e orderCreatedV1) (orderCreatedV2, error) {
+			return orderCreatedV2{}, nil
+		})
+		assert.ErrorIs(t, err, ErrUnknownEvent)
+
+		err = RegisterUpgrade(r, "orders", "1", "2", func(e orderCreatedV1) (orderCreatedV1, error) {
+			return e, nil
+		})
+		assert.ErrorIs(t, err, ErrEventTypeMismatch)
+	})
+}
@@ -2,10 +2,15 @@ package bikafka
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 const version = "version"
@@ -13,9 +18,25 @@ const version = "version"
 // Producer represents a Kafka producer
 type Producer struct {
 	writer *kafka.Writer
-	config *Config
+	// dlqWriter writes to the dead letter topic, it has no completion so the dead
+	// lettered messages are not reported as delivered
+	dlqWriter   *kafka.Writer
+	config      *Config
+	deadLetters []deadLetterQueue
+	metrics     *producerMetrics
+	// pending tracks the failed messages being dead lettered after their completion
+	pending sync.WaitGroup
 }
 
+// Publisher produces messages to Kafka, it is implemented by Producer and MockProducer
+type Publisher interface {
+	Produce(ctx context.Context, msg *Message) error
+	ProduceBatch(ctx context.Context, messages []*Message) error
+	Close() error
+}
+
+var _ Publisher = (*Producer)(nil)
+
 // Config holds the configuration for the Kafka producer
 type Config struct {
 	// BootstrapServers are the initial Kafka brokers for metadata discovery
@@ -25,21 +46,57 @@ type Config struct {
 	// Optional configurations
 	Compression kafka.Compression
 	Timeout     time.Duration
-	// SASL configuration
-	Username string
-	Password string
-	// TLS configuration
+	// SASL configuration, the mechanism defaults to PLAIN
+	Username      string
+	Password      string
+	SASLMechanism SASLMechanism
+	// TLS configuration, TLSConfig takes precedence over the PEM files
 	EnableTLS bool
-	// Required acks
+	TLSConfig *tls.Config
+	CAFile    string
+	CertFile  string
+	KeyFile   string
+	// Required acks, defaults to 1 unless set by one of the acks options
 	RequiredAcks int
+	acksSet      bool
 	// ClientID for identification
 	ClientID string
 	// Max message bytes
 	MaxMessageBytes int
-	// Async
+	// Async, the delivery errors are only reported to OnDelivery and the metrics
 	Async bool
+	// OnDelivery is called with the delivery report of each produced message
+	OnDelivery func(d Delivery)
+	// Meter records the delivered and failed messages, e.g. qmetrics.Meter("bikafka")
+	Meter metric.Meter
+	// Propagator injects the trace context into the produced messages and extracts it
+	// from the consumed ones, defaults to W3C trace context and baggage
+	Propagator propagation.TextMapPropagator
 	// Batch size
 	BatchSize int
+	// Partitioner of the produced messages, PartitionFunc takes precedence
+	Partitioner   Partitioner
+	PartitionFunc PartitionFunc
+	// Consumer group ID, required by the consumer
+	GroupID string
+	// Topics to consume
+	Topics []string
+	// Number of messages handled at the same time per partition, defaults to 1
+	Concurrency int
+	// Number of fetched messages waiting to be handled per partition, defaults to 100.
+	// Fetching blocks only when the queue of a partition is full.
+	PartitionQueueSize int
+	// Number of times a failed message is retried before the consumer stops
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// Interval of the offset commits, commits are synchronous if zero
+	CommitInterval time.Duration
+	// Retry topics of the consumer, the failed messages go through them in order
+	RetryTopics []RetryTopic
+	// Dead letter topic of the failed messages. The producer falls back to the
+	// dead letter file if the message cannot be produced to the topic either.
+	DeadLetterTopic string
+	DeadLetterFile  string
 }
 
 // Message represents a Kafka message
@@ -50,6 +107,9 @@ type Message struct {
 	Headers   []kafka.Header
 	Timestamp time.Time
 	Version   string
+	// Partition and Offset are only set on consumed messages
+	Partition int
+	Offset    int64
 }
 
 // NewProducer creates a new Kafka producer with the given configuration
@@ -77,7 +137,7 @@ func NewProducer(config *Config) (*Producer, error) {
 		config.ClientID = "bi-kafka-producer"
 	}
 
-	if config.RequiredAcks == 0 {
+	if config.RequiredAcks == 0 && !config.acksSet {
 		config.RequiredAcks = 1 // Wait for local acknowledgment
 	}
 
@@ -85,6 +145,16 @@ func NewProducer(config *Config) (*Producer, error) {
 		config.BatchSize = 100
 	}
 
+	transport, err := config.newTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	balancer, err := config.balancer()
+	if err != nil {
+		return nil, err
+	}
+
 	// Create kafka writer configuration
 	writer := &kafka.Writer{
 		Addr:         kafka.TCP(brokers...),
@@ -92,12 +162,39 @@ func NewProducer(config *Config) (*Producer, error) {
 		BatchSize:    config.BatchSize,
 		BatchTimeout: config.Timeout,
 		Async:        config.Async,
+		Compression:  config.Compression,
+		RequiredAcks: kafka.RequiredAcks(config.RequiredAcks),
+		Transport:    transport,
+		Balancer:     balancer,
+	}
+	if config.MaxMessageBytes > 0 {
+		writer.BatchBytes = int64(config.MaxMessageBytes)
 	}
 
-	return &Producer{
+	p := &Producer{
 		writer: writer,
 		config: config,
-	}, nil
+	}
+	writer.Completion = p.complete
+	if config.Meter != nil {
+		p.metrics = newProducerMetrics(config.Meter)
+	}
+	if config.DeadLetterTopic != "" {
+		p.dlqWriter = &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			MaxAttempts:  3,
+			BatchTimeout: config.Timeout,
+			RequiredAcks: kafka.RequireAll,
+			Transport:    transport,
+			Balancer:     balancer,
+		}
+		p.deadLetters = append(p.deadLetters, &topicDeadLetter{w: p.dlqWriter, topic: config.DeadLetterTopic})
+	}
+	if config.DeadLetterFile != "" {
+		p.deadLetters = append(p.deadLetters, &fileDeadLetter{path: config.DeadLetterFile})
+	}
+
+	return p, nil
 }
 
 // Produce sends a message to Kafka
@@ -109,6 +206,8 @@ func (p *Producer) Produce(ctx context.Context, msg *Message) error {
 	if msg.Topic == "" {
 		return fmt.Errorf("topic cannot be empty")
 	}
+
+	ctx, span := p.startPublish(ctx, []*Message{msg})
 	msg.Headers = append(msg.Headers, kafka.Header{
 		Key:   version,
 		Value: []byte(msg.Version),
@@ -129,10 +228,11 @@ func (p *Producer) Produce(ctx context.Context, msg *Message) error {
 	// Send message with context
 	err := p.writer.WriteMessages(ctx, kafkaMsg)
 	if err != nil {
-		return fmt.Errorf("failed to send message to topic %s: %w", msg.Topic, err)
+		err = p.deadLetter(ctx, []kafka.Message{kafkaMsg}, fmt.Errorf("failed to send message to topic %s: %w", msg.Topic, err))
 	}
+	endSpan(span, err)
 
-	return nil
+	return err
 }
 
 // ProduceBatch sends multiple messages to Kafka
@@ -141,15 +241,57 @@ func (p *Producer) ProduceBatch(ctx context.Context, messages []*Message) error
 		return nil
 	}
 
+	ctx, span := p.startPublish(ctx, messages)
+	kafkaMessages, err := kafkaMessages(messages)
+	if err != nil {
+		endSpan(span, err)
+
+		return err
+	}
+
+	// Send all messages with context
+	err = p.writer.WriteMessages(ctx, kafkaMessages...)
+	if err != nil {
+		err = p.deadLetter(ctx, failedMessages(kafkaMessages, err), fmt.Errorf("failed to send batch messages: %w", err))
+	}
+	endSpan(span, err)
+
+	return err
+}
+
+// Close closes the producer, it waits for the failed messages being dead lettered
+func (p *Producer) Close() error {
+	err := p.writer.Close()
+	p.pending.Wait()
+	if p.dlqWriter != nil {
+		err = errors.Join(err, p.dlqWriter.Close())
+	}
+
+	return err
+}
+
+// GetBootstrapServers returns the bootstrap servers being used
+func (p *Producer) GetBootstrapServers() []string {
+	if len(p.config.BootstrapServers) > 0 {
+		return p.config.BootstrapServers
+	}
+	return p.config.Brokers
+}
+
+// kafkaMessages converts the messages to be written and adds their version header
+func kafkaMessages(messages []*Message) ([]kafka.Message, error) {
 	kafkaMessages := make([]kafka.Message, len(messages))
 	for i, msg := range messages {
 		if msg == nil {
-			return fmt.Errorf("message at index %d is nil", i)
+			return nil, fmt.Errorf("message at index %d is nil", i)
 		}
 
 		if msg.Topic == "" {
-			return fmt.Errorf("topic cannot be empty for message at index %d", i)
+			return nil, fmt.Errorf("topic cannot be empty for message at index %d", i)
 		}
+	}
+
+	for i, msg := range messages {
 		msg.Headers = append(msg.Headers, kafka.Header{
 			Key:   version,
 			Value: []byte(msg.Version),
@@ -166,24 +308,5 @@ func (p *Producer) ProduceBatch(ctx context.Context, messages []*Message) error
 		}
 	}
 
-	// Send all messages with context
-	err := p.writer.WriteMessages(ctx, kafkaMessages...)
-	if err != nil {
-		return fmt.Errorf("failed to send batch messages: %w", err)
-	}
-
-	return nil
-}
-
-// Close closes the producer
-func (p *Producer) Close() error {
-	return p.writer.Close()
-}
-
-// GetBootstrapServers returns the bootstrap servers being used
-func (p *Producer) GetBootstrapServers() []string {
-	if len(p.config.BootstrapServers) > 0 {
-		return p.config.BootstrapServers
-	}
-	return p.config.Brokers
+	return kafkaMessages, nil
 }
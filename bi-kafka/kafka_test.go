@@ -2,11 +2,14 @@ package bikafka
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // createMockProducer creates a producer with a mock for testing
@@ -81,7 +84,7 @@ func TestProducer_Produce(t *testing.T) {
 		producer := createMockProducerWithoutExpectation(t, config)
 		defer producer.Close()
 
-		err := producer.Produce(context.Background(), nil, "1")
+		err := producer.Produce(context.Background(), nil)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "message cannot be nil")
 	})
@@ -94,11 +97,12 @@ func TestProducer_Produce(t *testing.T) {
 		defer producer.Close()
 
 		msg := &Message{
-			Topic: "",
-			Value: []byte("test message"),
+			Topic:   "",
+			Value:   []byte("test message"),
+			Version: "1",
 		}
 
-		err := producer.Produce(context.Background(), msg, "1")
+		err := producer.Produce(context.Background(), msg)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "topic cannot be empty")
 	})
@@ -111,12 +115,13 @@ func TestProducer_Produce(t *testing.T) {
 		defer producer.Close()
 
 		msg := &Message{
-			Topic: "test-topic",
-			Key:   []byte("test-key"),
-			Value: []byte("test message"),
+			Topic:   "test-topic",
+			Key:     []byte("test-key"),
+			Value:   []byte("test message"),
+			Version: "1",
 		}
 
-		err := producer.Produce(context.Background(), msg, "1")
+		err := producer.Produce(context.Background(), msg)
 		assert.NoError(t, err)
 	})
 
@@ -128,11 +133,12 @@ func TestProducer_Produce(t *testing.T) {
 		defer producer.Close()
 
 		msg := &Message{
-			Topic: "test-topic",
-			Value: []byte("test message"),
+			Topic:   "test-topic",
+			Value:   []byte("test message"),
+			Version: "2.0",
 		}
 
-		err := producer.Produce(context.Background(), msg, "2.0")
+		err := producer.Produce(context.Background(), msg)
 		assert.NoError(t, err)
 
 		// Check that version header was added
@@ -152,18 +158,20 @@ func TestProducer_ProduceBatch(t *testing.T) {
 
 		messages := []*Message{
 			{
-				Topic: "test-topic",
-				Key:   []byte("key1"),
-				Value: []byte("test message 1"),
+				Topic:   "test-topic",
+				Key:     []byte("key1"),
+				Value:   []byte("test message 1"),
+				Version: "1",
 			},
 			{
-				Topic: "test-topic",
-				Key:   []byte("key2"),
-				Value: []byte("test message 2"),
+				Topic:   "test-topic",
+				Key:     []byte("key2"),
+				Value:   []byte("test message 2"),
+				Version: "1",
 			},
 		}
 
-		err := producer.ProduceBatch(context.Background(), messages, "1")
+		err := producer.ProduceBatch(context.Background(), messages)
 		assert.NoError(t, err)
 	})
 }
@@ -268,12 +276,13 @@ func TestMockProducer(t *testing.T) {
 		defer mock.Close()
 
 		msg := &Message{
-			Topic: "test-topic",
-			Key:   []byte("test-key"),
-			Value: []byte("test-value"),
+			Topic:   "test-topic",
+			Key:     []byte("test-key"),
+			Value:   []byte("test-value"),
+			Version: "1.0",
 		}
 
-		err := mock.Produce(context.Background(), msg, "1.0")
+		err := mock.Produce(context.Background(), msg)
 		assert.NoError(t, err)
 		assert.Equal(t, 1, mock.GetMessageCount())
 
@@ -294,18 +303,20 @@ func TestMockProducer(t *testing.T) {
 
 		messages := []*Message{
 			{
-				Topic: "test-topic",
-				Key:   []byte("key1"),
-				Value: []byte("value1"),
+				Topic:   "test-topic",
+				Key:     []byte("key1"),
+				Value:   []byte("value1"),
+				Version: "2.0",
 			},
 			{
-				Topic: "test-topic",
-				Key:   []byte("key2"),
-				Value: []byte("value2"),
+				Topic:   "test-topic",
+				Key:     []byte("key2"),
+				Value:   []byte("value2"),
+				Version: "2.0",
 			},
 		}
 
-		err := mock.ProduceBatch(context.Background(), messages, "2.0")
+		err := mock.ProduceBatch(context.Background(), messages)
 		assert.NoError(t, err)
 		assert.Equal(t, 2, mock.GetMessageCount())
 
@@ -323,11 +334,12 @@ func TestMockProducer(t *testing.T) {
 		defer mock.Close()
 
 		msg := &Message{
-			Topic: "test-topic",
-			Value: []byte("test-value"),
+			Topic:   "test-topic",
+			Value:   []byte("test-value"),
+			Version: "1.0",
 		}
 
-		err := mock.Produce(context.Background(), msg, "1.0")
+		err := mock.Produce(context.Background(), msg)
 		assert.NoError(t, err)
 		assert.Equal(t, 1, mock.GetMessageCount())
 
@@ -356,12 +368,98 @@ func TestMockProducer(t *testing.T) {
 		mock.Close()
 
 		msg := &Message{
-			Topic: "test-topic",
-			Value: []byte("test-value"),
+			Topic:   "test-topic",
+			Value:   []byte("test-value"),
+			Version: "1.0",
 		}
 
-		err := mock.Produce(context.Background(), msg, "1.0")
+		err := mock.Produce(context.Background(), msg)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "writer is closed")
 	})
 }
+
+// recordingT records the failures of the assertion helpers
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestMockProducer_Injection(t *testing.T) {
+	errProduce := errors.New("produce failed")
+	config := &Config{
+		BootstrapServers: []string{"localhost:9092"},
+	}
+
+	t.Run("failure injection", func(t *testing.T) {
+		mock := NewMockProducer(config)
+		defer mock.Close()
+
+		var p Publisher = mock
+		mock.FailNext(1, errProduce)
+		assert.ErrorIs(t, p.Produce(context.Background(), &Message{Topic: "orders"}), errProduce)
+		assert.NoError(t, p.Produce(context.Background(), &Message{Topic: "orders"}))
+
+		mock.FailTopic("payments", errProduce)
+		err := p.ProduceBatch(context.Background(), []*Message{{Topic: "orders"}, {Topic: "payments"}})
+		assert.ErrorIs(t, err, errProduce)
+		mock.FailTopic("payments", nil)
+		assert.NoError(t, p.Produce(context.Background(), &Message{Topic: "payments"}))
+
+		mock.SetError(errProduce)
+		assert.ErrorIs(t, p.Produce(context.Background(), &Message{Topic: "orders"}), errProduce)
+		mock.SetError(nil)
+
+		// The failed calls write nothing.
+		assert.Equal(t, 2, mock.GetMessageCount())
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		mock := NewMockProducer(config)
+		defer mock.Close()
+		mock.SetLatency(20 * time.Millisecond)
+
+		start := time.Now()
+		assert.NoError(t, mock.Produce(context.Background(), &Message{Topic: "orders"}))
+		assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, mock.Produce(ctx, &Message{Topic: "orders"}), context.DeadlineExceeded)
+	})
+
+	t.Run("per topic inspection and assertions", func(t *testing.T) {
+		mock := NewMockProducer(config)
+		defer mock.Close()
+
+		err := mock.ProduceBatch(context.Background(), []*Message{
+			{Topic: "orders", Key: []byte("o1"), Version: "2"},
+			{Topic: "payments", Key: []byte("p1"), Version: "1", Headers: []kafka.Header{{Key: "source", Value: []byte("pos")}}},
+			{Topic: "orders", Key: []byte("o2"), Version: "2"},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"orders", "payments"}, mock.Topics())
+		orders := mock.GetTopicMessages("orders")
+		require.Len(t, orders, 2)
+		assert.Equal(t, "2", orders[1].Version)
+		assert.Equal(t, []byte("o2"), orders[1].Key)
+
+		mock.AssertProduced(t, "orders", MatchAll(MatchKey([]byte("o1")), MatchVersion("2")))
+		mock.AssertProduced(t, "payments", MatchHeader("source", "pos"))
+		mock.AssertNotProduced(t, "refunds", nil)
+
+		rt := &recordingT{}
+		assert.False(t, mock.AssertProduced(rt, "orders", MatchKey([]byte("p1"))))
+		assert.False(t, mock.AssertNotProduced(rt, "orders", nil))
+		assert.Equal(t, []string{
+			`no matching message produced to topic "orders", produced to [orders payments]`,
+			`2 matching messages produced to topic "orders"`,
+		}, rt.errors)
+	})
+}
@@ -1,8 +1,10 @@
 package bikafka
 
 import (
+	"bytes"
 	"context"
 	"sync"
+	"time"
 
 	"github.com/segmentio/kafka-go"
 )
@@ -87,18 +89,96 @@ func (m *MockWriter) IsClosed() bool {
 type MockProducer struct {
 	writer *MockWriter
 	config *Config
+
+	mu        sync.Mutex
+	err       error
+	failNext  []error
+	topicErrs map[string]error
+	latency   time.Duration
 }
 
+var _ Publisher = (*MockProducer)(nil)
+
 // NewMockProducer creates a new mock producer
 func NewMockProducer(config *Config) *MockProducer {
 	return &MockProducer{
-		writer: NewMockWriter(),
-		config: config,
+		writer:    NewMockWriter(),
+		config:    config,
+		topicErrs: make(map[string]error),
+	}
+}
+
+// SetError makes all the following produce calls fail with err, nil clears it
+func (m *MockProducer) SetError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// FailNext makes the next n produce calls fail with err
+func (m *MockProducer) FailNext(n int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := 0; i < n; i++ {
+		m.failNext = append(m.failNext, err)
 	}
 }
 
-// Produce implements the Producer interface
-func (m *MockProducer) Produce(ctx context.Context, msg *Message, version string) error {
+// FailTopic makes the produce calls with a message for the topic fail with err, nil
+// clears it
+func (m *MockProducer) FailTopic(topic string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		delete(m.topicErrs, topic)
+
+		return
+	}
+	m.topicErrs[topic] = err
+}
+
+// SetLatency delays the produce calls, as if they wait for the broker
+func (m *MockProducer) SetLatency(latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latency = latency
+}
+
+// inject applies the latency and returns the injected error of the call, if any
+func (m *MockProducer) inject(ctx context.Context, messages []*Message) error {
+	m.mu.Lock()
+	latency := m.latency
+	err := m.err
+	if err == nil && len(m.failNext) > 0 {
+		err = m.failNext[0]
+		m.failNext = m.failNext[1:]
+	}
+	if err == nil {
+		for _, msg := range messages {
+			if topicErr, ok := m.topicErrs[msg.Topic]; ok {
+				err = topicErr
+
+				break
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	if latency > 0 {
+		t := time.NewTimer(latency)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
+
+// Produce implements the Publisher interface
+func (m *MockProducer) Produce(ctx context.Context, msg *Message) error {
 	if msg == nil {
 		return ErrMessageNil
 	}
@@ -107,10 +187,14 @@ func (m *MockProducer) Produce(ctx context.Context, msg *Message, version string
 		return ErrTopicEmpty
 	}
 
+	if err := m.inject(ctx, []*Message{msg}); err != nil {
+		return err
+	}
+
 	// Add version header
 	msg.Headers = append(msg.Headers, kafka.Header{
-		Key:   "version",
-		Value: []byte(version),
+		Key:   version,
+		Value: []byte(msg.Version),
 	})
 
 	// Create kafka message
@@ -129,14 +213,13 @@ func (m *MockProducer) Produce(ctx context.Context, msg *Message, version string
 	return m.writer.WriteMessages(ctx, kafkaMsg)
 }
 
-// ProduceBatch implements the Producer interface
-func (m *MockProducer) ProduceBatch(ctx context.Context, messages []*Message, version string) error {
+// ProduceBatch implements the Publisher interface
+func (m *MockProducer) ProduceBatch(ctx context.Context, messages []*Message) error {
 	if len(messages) == 0 {
 		return nil
 	}
 
-	kafkaMessages := make([]kafka.Message, len(messages))
-	for i, msg := range messages {
+	for _, msg := range messages {
 		if msg == nil {
 			return ErrMessageNil
 		}
@@ -144,11 +227,18 @@ func (m *MockProducer) ProduceBatch(ctx context.Context, messages []*Message, ve
 		if msg.Topic == "" {
 			return ErrTopicEmpty
 		}
+	}
+
+	if err := m.inject(ctx, messages); err != nil {
+		return err
+	}
 
+	kafkaMessages := make([]kafka.Message, len(messages))
+	for i, msg := range messages {
 		// Add version header
 		msg.Headers = append(msg.Headers, kafka.Header{
-			Key:   "version",
-			Value: []byte(version),
+			Key:   version,
+			Value: []byte(msg.Version),
 		})
 
 		kafkaMessages[i] = kafka.Message{
@@ -167,7 +257,7 @@ func (m *MockProducer) ProduceBatch(ctx context.Context, messages []*Message, ve
 	return m.writer.WriteMessages(ctx, kafkaMessages...)
 }
 
-// Close implements the Producer interface
+// Close implements the Publisher interface
 func (m *MockProducer) Close() error {
 	return m.writer.Close()
 }
@@ -185,6 +275,34 @@ func (m *MockProducer) GetMessages() []kafka.Message {
 	return m.writer.GetMessages()
 }
 
+// GetTopicMessages returns the messages written to the topic, in order
+func (m *MockProducer) GetTopicMessages(topic string) []*Message {
+	var messages []*Message
+	for _, km := range m.writer.GetMessages() {
+		if km.Topic == topic {
+			messages = append(messages, messageFromKafka(km))
+		}
+	}
+
+	return messages
+}
+
+// Topics returns the topics the messages are written to, in the order of their first message
+func (m *MockProducer) Topics() []string {
+	var (
+		topics []string
+		seen   = make(map[string]bool)
+	)
+	for _, km := range m.writer.GetMessages() {
+		if !seen[km.Topic] {
+			seen[km.Topic] = true
+			topics = append(topics, km.Topic)
+		}
+	}
+
+	return topics
+}
+
 // GetMessageCount returns the number of messages written
 func (m *MockProducer) GetMessageCount() int {
 	return m.writer.GetMessageCount()
@@ -200,6 +318,91 @@ func (m *MockProducer) IsClosed() bool {
 	return m.writer.IsClosed()
 }
 
+// TestingT is the part of testing.T used by the assertion helpers
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// MessageMatcher reports whether a produced message is the expected one. The version
+// of the message is parsed from its version header.
+type MessageMatcher func(msg *Message) bool
+
+// MatchKey matches the messages with the key
+func MatchKey(key []byte) MessageMatcher {
+	return func(msg *Message) bool {
+		return bytes.Equal(msg.Key, key)
+	}
+}
+
+// MatchVersion matches the messages with the version
+func MatchVersion(v string) MessageMatcher {
+	return func(msg *Message) bool {
+		return msg.Version == v
+	}
+}
+
+// MatchHeader matches the messages with the header
+func MatchHeader(key, value string) MessageMatcher {
+	return func(msg *Message) bool {
+		v, ok := headerValue(msg.Headers, key)
+
+		return ok && v == value
+	}
+}
+
+// MatchAll matches the messages matched by all the matchers
+func MatchAll(matchers ...MessageMatcher) MessageMatcher {
+	return func(msg *Message) bool {
+		for _, match := range matchers {
+			if !match(msg) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// AssertProduced checks that a message matched by matcher is written to the topic,
+// a nil matcher matches any message
+func (m *MockProducer) AssertProduced(t TestingT, topic string, matcher MessageMatcher) bool {
+	t.Helper()
+
+	if m.countMatches(topic, matcher) == 0 {
+		t.Errorf("no matching message produced to topic %q, produced to %v", topic, m.Topics())
+
+		return false
+	}
+
+	return true
+}
+
+// AssertNotProduced checks that no message matched by matcher is written to the topic,
+// a nil matcher matches any message
+func (m *MockProducer) AssertNotProduced(t TestingT, topic string, matcher MessageMatcher) bool {
+	t.Helper()
+
+	if n := m.countMatches(topic, matcher); n > 0 {
+		t.Errorf("%d matching messages produced to topic %q", n, topic)
+
+		return false
+	}
+
+	return true
+}
+
+func (m *MockProducer) countMatches(topic string, matcher MessageMatcher) int {
+	n := 0
+	for _, msg := range m.GetTopicMessages(topic) {
+		if matcher == nil || matcher(msg) {
+			n++
+		}
+	}
+
+	return n
+}
+
 // Error definitions
 var (
 	ErrWriterClosed = &MockError{"writer is closed"}
@@ -1,9 +1,12 @@
 package bikafka
 
 import (
+	"crypto/tls"
 	"time"
 
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 // Option is a function that configures a Producer
@@ -52,6 +55,16 @@ func WithSASL(username, password string) Option {
 	}
 }
 
+// WithSCRAM sets SCRAM authentication credentials, mechanism must be
+// SASLScramSHA256 or SASLScramSHA512
+func WithSCRAM(mechanism SASLMechanism, username, password string) Option {
+	return func(c *Config) {
+		c.SASLMechanism = mechanism
+		c.Username = username
+		c.Password = password
+	}
+}
+
 // WithTLS enables TLS encryption
 func WithTLS() Option {
 	return func(c *Config) {
@@ -59,6 +72,25 @@ func WithTLS() Option {
 	}
 }
 
+// WithTLSConfig enables TLS encryption with a custom configuration
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(c *Config) {
+		c.EnableTLS = true
+		c.TLSConfig = tlsConfig
+	}
+}
+
+// WithTLSFiles enables TLS encryption with a CA certificate and an optional client
+// certificate, loaded from PEM files. Empty paths are ignored.
+func WithTLSFiles(caFile, certFile, keyFile string) Option {
+	return func(c *Config) {
+		c.EnableTLS = true
+		c.CAFile = caFile
+		c.CertFile = certFile
+		c.KeyFile = keyFile
+	}
+}
+
 // WithMaxMessageBytes sets the maximum message size
 func WithMaxMessageBytes(maxBytes int) Option {
 	return func(c *Config) {
@@ -95,18 +127,133 @@ func WithZstdCompression() Option {
 func WithWaitForAll() Option {
 	return func(c *Config) {
 		c.RequiredAcks = -1 // Wait for all in-sync replicas
+		c.acksSet = true
 	}
 }
 
 func WithWaitForLocal() Option {
 	return func(c *Config) {
 		c.RequiredAcks = 1 // Wait for local acknowledgment
+		c.acksSet = true
 	}
 }
 
 func WithNoResponse() Option {
 	return func(c *Config) {
 		c.RequiredAcks = 0 // No acknowledgment required
+		c.acksSet = true
+	}
+}
+
+// Consumer options
+func WithGroupID(groupID string) Option {
+	return func(c *Config) {
+		c.GroupID = groupID
+	}
+}
+
+func WithTopics(topics ...string) Option {
+	return func(c *Config) {
+		c.Topics = topics
+	}
+}
+
+// WithConcurrency sets the number of messages handled at the same time per partition
+func WithConcurrency(concurrency int) Option {
+	return func(c *Config) {
+		c.Concurrency = concurrency
+	}
+}
+
+// WithPartitionQueueSize sets how many fetched messages can wait to be handled per
+// partition before fetching blocks
+func WithPartitionQueueSize(size int) Option {
+	return func(c *Config) {
+		c.PartitionQueueSize = size
+	}
+}
+
+// WithRetries sets how many times a failed message is retried and the backoff
+// between the attempts
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Config) {
+		c.MaxRetries = maxRetries
+		c.RetryBackoff = backoff
+	}
+}
+
+// WithCommitInterval commits the offsets periodically instead of after each message
+func WithCommitInterval(interval time.Duration) Option {
+	return func(c *Config) {
+		c.CommitInterval = interval
+	}
+}
+
+// WithRetryTopic adds a retry tier to the consumer, the messages failed after all
+// their retries are sent to the topic and handled again after delay. The tiers are
+// tried in the order they are added.
+func WithRetryTopic(topic string, delay time.Duration) Option {
+	return func(c *Config) {
+		c.RetryTopics = append(c.RetryTopics, RetryTopic{Topic: topic, Delay: delay})
+	}
+}
+
+// WithDeadLetterTopic sends the messages which could not be produced or handled to
+// the topic
+func WithDeadLetterTopic(topic string) Option {
+	return func(c *Config) {
+		c.DeadLetterTopic = topic
+	}
+}
+
+// WithDeadLetterFile appends the messages which could not be produced to a local file
+func WithDeadLetterFile(path string) Option {
+	return func(c *Config) {
+		c.DeadLetterFile = path
+	}
+}
+
+// WithAsync makes the producer asynchronous, the delivery errors are reported to the
+// delivery callback and the metrics
+func WithAsync() Option {
+	return func(c *Config) {
+		c.Async = true
+	}
+}
+
+// WithDeliveryCallback sets the function called with the delivery report of each
+// produced message
+func WithDeliveryCallback(fn func(d Delivery)) Option {
+	return func(c *Config) {
+		c.OnDelivery = fn
+	}
+}
+
+// WithMetrics records the delivered and failed messages by the meter
+func WithMetrics(meter metric.Meter) Option {
+	return func(c *Config) {
+		c.Meter = meter
+	}
+}
+
+// WithPropagator sets the propagator of the trace context
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(c *Config) {
+		c.Propagator = propagator
+	}
+}
+
+// WithPartitioner sets the partitioner of the produced messages
+func WithPartitioner(partitioner Partitioner) Option {
+	return func(c *Config) {
+		c.Partitioner = partitioner
+	}
+}
+
+// WithPartitionFunc sets a custom partitioner of the produced messages
+func WithPartitionFunc(fn PartitionFunc) Option {
+	return func(c *Config) {
+		c.PartitionFunc = fn
 	}
 }
 
@@ -0,0 +1,347 @@
+package bikafka
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Dialect selects the SQL flavour of the outbox table
+type Dialect int
+
+const (
+	DialectPostgres Dialect = iota
+	DialectMySQL
+	DialectSQLite
+)
+
+const (
+	defaultOutboxTable    = "kafka_outbox"
+	outboxCleanupInterval = time.Minute
+)
+
+// HeaderOutboxID is added to the relayed messages, together with the message key it
+// lets the consumers drop the duplicates of a message relayed more than once
+const HeaderOutboxID = "outbox-id"
+
+// Execer is implemented by *sql.Tx, *sql.Conn and *sql.DB
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Outbox stores the messages in a database/sql table inside the transaction of the
+// caller, so they are produced by the Relay if and only if the transaction commits
+type Outbox struct {
+	db      *sql.DB
+	dialect Dialect
+	table   string
+}
+
+// NewOutbox creates an outbox on top of db. If table is empty "kafka_outbox" is used.
+// Call CreateTable once to create the table if it does not exist.
+func NewOutbox(db *sql.DB, dialect Dialect, table string) *Outbox {
+	if table == "" {
+		table = defaultOutboxTable
+	}
+
+	return &Outbox{
+		db:      db,
+		dialect: dialect,
+		table:   table,
+	}
+}
+
+// CreateTable creates the table and its index if they do not exist
+func (o *Outbox) CreateTable(ctx context.Context) error {
+	var stmts []string
+	switch o.dialect {
+	case DialectMySQL:
+		stmts = []string{
+			fmt.Sprintf(
+				"CREATE TABLE IF NOT EXISTS %s (id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY, "+
+					"topic VARCHAR(255) NOT NULL, msg_key LONGBLOB, value LONGBLOB, headers TEXT, "+
+					"version VARCHAR(64) NOT NULL DEFAULT '', created_at BIGINT NOT NULL, "+
+					"sent_at BIGINT NOT NULL DEFAULT 0, INDEX %s_sent_at_idx (sent_at, id))",
+				o.table, o.table,
+			),
+		}
+	default:
+		id, blob := "INTEGER PRIMARY KEY AUTOINCREMENT", "BLOB"
+		if o.dialect == DialectPostgres {
+			id, blob = "BIGSERIAL PRIMARY KEY", "BYTEA"
+		}
+		stmts = []string{
+			fmt.Sprintf(
+				"CREATE TABLE IF NOT EXISTS %s (id %s, topic VARCHAR(255) NOT NULL, msg_key %s, "+
+					"value %s, headers TEXT, version VARCHAR(64) NOT NULL DEFAULT '', "+
+					"created_at BIGINT NOT NULL, sent_at BIGINT NOT NULL DEFAULT 0)",
+				o.table, id, blob, blob,
+			),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_sent_at_idx ON %s (sent_at, id)", o.table, o.table),
+		}
+	}
+
+	for _, stmt := range stmts {
+		if _, err := o.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Write inserts the messages into the outbox using tx, which is usually the
+// transaction of the changes the messages are about
+func (o *Outbox) Write(ctx context.Context, tx Execer, msgs ...*Message) error {
+	q := o.rebind("INSERT INTO %s (topic, msg_key, value, headers, version, created_at) VALUES (?, ?, ?, ?, ?, ?)")
+	for i, msg := range msgs {
+		if msg == nil {
+			return fmt.Errorf("message at index %d is nil", i)
+		}
+		if msg.Topic == "" {
+			return fmt.Errorf("topic cannot be empty for message at index %d", i)
+		}
+
+		headers, err := json.Marshal(msg.Headers)
+		if err != nil {
+			return err
+		}
+		ts := msg.Timestamp
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+
+		_, err = tx.ExecContext(ctx, q, msg.Topic, msg.Key, msg.Value, string(headers), msg.Version, ts.UnixMilli())
+		if err != nil {
+			return fmt.Errorf("failed to write message to outbox: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Relay publishes the messages of the outbox in order and marks them sent. A message
+// may be published more than once if the relay crashes or the marking fails, so the
+// consumers should be idempotent on the message key or the outbox-id header. Several
+// relays can run on Postgres and MySQL, they skip the rows locked by each other.
+type Relay struct {
+	outbox    *Outbox
+	producer  Publisher
+	batchSize int
+	interval  time.Duration
+	retention time.Duration
+	onError   func(err error)
+	notify    chan struct{}
+}
+
+type RelayOption func(r *Relay)
+
+// WithRelayBatchSize sets the maximum number of messages published at once, default is
+// 100. Non-positive sizes keep the default.
+func WithRelayBatchSize(size int) RelayOption {
+	return func(r *Relay) {
+		if size > 0 {
+			r.batchSize = size
+		}
+	}
+}
+
+// WithRelayInterval sets the polling interval of the outbox, default is 1 second.
+// Non-positive intervals keep the default.
+func WithRelayInterval(interval time.Duration) RelayOption {
+	return func(r *Relay) {
+		if interval > 0 {
+			r.interval = interval
+		}
+	}
+}
+
+// WithRelayRetention sets how long the sent messages are kept, default is 24 hours
+func WithRelayRetention(retention time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.retention = retention
+	}
+}
+
+// WithRelayErrorHandler sets the function called with the errors of Run, which keeps
+// running after them
+func WithRelayErrorHandler(fn func(err error)) RelayOption {
+	return func(r *Relay) {
+		r.onError = fn
+	}
+}
+
+// NewRelay creates a relay which publishes the messages of the outbox with producer
+func NewRelay(outbox *Outbox, producer Publisher, opts ...RelayOption) *Relay {
+	r := &Relay{
+		outbox:    outbox,
+		producer:  producer,
+		batchSize: 100,
+		interval:  time.Second,
+		retention: 24 * time.Hour,
+		onError:   func(error) {},
+		notify:    make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Notify wakes up the relay, e.g. after committing a transaction which wrote to the
+// outbox, so the messages are published without waiting for the next poll
+func (r *Relay) Notify() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run relays the messages until ctx is done. The outbox is polled every interval, or
+// right away if the last batch was full or Notify is called.
+func (r *Relay) Run(ctx context.Context) error {
+	poll := time.NewTicker(r.interval)
+	defer poll.Stop()
+	cleanup := time.NewTicker(outboxCleanupInterval)
+	defer cleanup.Stop()
+
+	for {
+		n, err := r.RelayOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.onError(err)
+		}
+		if err == nil && n == r.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-poll.C:
+		case <-r.notify:
+		case <-cleanup.C:
+			if _, err := r.Cleanup(ctx); err != nil && ctx.Err() == nil {
+				r.onError(err)
+			}
+		}
+	}
+}
+
+// RelayOnce publishes a batch of unsent messages and returns the number of published
+// messages. The messages dead lettered by the producer are considered sent.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	o := r.outbox
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	q := "SELECT id, topic, msg_key, value, headers, version, created_at FROM %s WHERE sent_at = 0 ORDER BY id LIMIT ?"
+	if o.dialect != DialectSQLite {
+		q += " FOR UPDATE SKIP LOCKED"
+	}
+	rows, err := tx.QueryContext(ctx, o.rebind(q), r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		ids  []any
+		msgs []*Message
+	)
+	for rows.Next() {
+		var (
+			id        int64
+			headers   sql.NullString
+			createdAt int64
+			msg       Message
+		)
+		if err := rows.Scan(&id, &msg.Topic, &msg.Key, &msg.Value, &headers, &msg.Version, &createdAt); err != nil {
+			_ = rows.Close()
+
+			return 0, err
+		}
+		if headers.Valid && headers.String != "" {
+			if err := json.Unmarshal([]byte(headers.String), &msg.Headers); err != nil {
+				_ = rows.Close()
+
+				return 0, fmt.Errorf("invalid headers of outbox message %d: %w", id, err)
+			}
+		}
+		msg.Headers = append(msg.Headers, kafka.Header{Key: HeaderOutboxID, Value: []byte(fmt.Sprint(id))})
+		msg.Timestamp = time.UnixMilli(createdAt)
+
+		ids = append(ids, id)
+		msgs = append(msgs, &msg)
+	}
+	if err := errors.Join(rows.Err(), rows.Close()); err != nil {
+		return 0, err
+	}
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+
+	if err := r.producer.ProduceBatch(ctx, msgs); err != nil && !errors.Is(err, ErrDeadLettered) {
+		return 0, err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	_, err = tx.ExecContext(
+		ctx,
+		o.rebind("UPDATE %s SET sent_at = ? WHERE id IN ("+placeholders+")"),
+		append([]any{time.Now().UnixMilli()}, ids...)...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark outbox messages sent: %w", err)
+	}
+
+	return len(msgs), tx.Commit()
+}
+
+// Cleanup removes the messages sent before the retention and returns the number of
+// removed messages
+func (r *Relay) Cleanup(ctx context.Context) (int64, error) {
+	res, err := r.outbox.db.ExecContext(
+		ctx,
+		r.outbox.rebind("DELETE FROM %s WHERE sent_at <> 0 AND sent_at <= ?"),
+		time.Now().Add(-r.retention).UnixMilli(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// rebind formats the table name into q and converts the '?' placeholders to the
+// dialect's placeholders
+func (o *Outbox) rebind(q string) string {
+	q = fmt.Sprintf(q, o.table)
+	if o.dialect != DialectPostgres {
+		return q
+	}
+
+	var (
+		sb strings.Builder
+		n  int
+	)
+	for i := 0; i < len(q); i++ {
+		if q[i] != '?' {
+			sb.WriteByte(q[i])
+
+			continue
+		}
+		n++
+		fmt.Fprintf(&sb, "$%d", n)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,197 @@
+package bikafka
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestOutbox(t *testing.T) *Outbox {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "outbox.db")+"?_busy_timeout=5000")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	o := NewOutbox(db, DialectSQLite, "")
+	require.NoError(t, o.CreateTable(context.Background()))
+
+	return o
+}
+
+// writeOutbox writes the messages in a transaction which is committed if commit is true
+func writeOutbox(t *testing.T, o *Outbox, commit bool, msgs ...*Message) {
+	ctx := context.Background()
+	tx, err := o.db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	require.NoError(t, o.Write(ctx, tx, msgs...))
+	if commit {
+		require.NoError(t, tx.Commit())
+	} else {
+		require.NoError(t, tx.Rollback())
+	}
+}
+
+// unsent returns the ids of the unsent messages of the outbox
+func unsent(t *testing.T, o *Outbox) []int64 {
+	rows, err := o.db.Query("SELECT id FROM kafka_outbox WHERE sent_at = 0 ORDER BY id")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		require.NoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	require.NoError(t, rows.Err())
+
+	return ids
+}
+
+func outboxMessages(n int) []*Message {
+	msgs := make([]*Message, n)
+	for i := range msgs {
+		msgs[i] = &Message{
+			Topic:   "orders",
+			Key:     []byte(fmt.Sprintf("order-%d", i)),
+			Value:   []byte("created"),
+			Version: "1",
+		}
+	}
+
+	return msgs
+}
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("rolled back messages are not relayed", func(t *testing.T) {
+		o := newTestOutbox(t)
+		producer := NewMockProducer(&Config{})
+		writeOutbox(t, o, false, outboxMessages(2)...)
+
+		n, err := NewRelay(o, producer).RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+		assert.Zero(t, producer.GetMessageCount())
+	})
+
+	t.Run("committed messages are relayed in order and marked sent", func(t *testing.T) {
+		o := newTestOutbox(t)
+		producer := NewMockProducer(&Config{})
+		msgs := outboxMessages(3)
+		msgs[1].Headers = append(msgs[1].Headers, kafka.Header{Key: "trace", Value: []byte("x")})
+		writeOutbox(t, o, true, msgs[0])
+		writeOutbox(t, o, true, msgs[1:]...)
+
+		relay := NewRelay(o, producer, WithRelayBatchSize(2))
+		n, err := relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, []int64{3}, unsent(t, o))
+
+		n, err = relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Empty(t, unsent(t, o))
+
+		relayed := producer.GetTopicMessages("orders")
+		require.Len(t, relayed, 3)
+		for i, msg := range relayed {
+			assert.Equal(t, fmt.Sprintf("order-%d", i), string(msg.Key))
+			assert.Equal(t, "1", msg.Version)
+			assert.Equal(t, fmt.Sprint(i+1), header(t, msg.Headers, HeaderOutboxID))
+		}
+		assert.Equal(t, "x", header(t, relayed[1].Headers, "trace"))
+
+		n, err = relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+		assert.Equal(t, 3, producer.GetMessageCount())
+	})
+
+	t.Run("messages stay unsent if the producer fails", func(t *testing.T) {
+		o := newTestOutbox(t)
+		producer := NewMockProducer(&Config{})
+		producer.FailNext(1, errors.New("broker down"))
+		writeOutbox(t, o, true, outboxMessages(2)...)
+
+		relay := NewRelay(o, producer)
+		_, err := relay.RelayOnce(ctx)
+		assert.ErrorContains(t, err, "broker down")
+		assert.Equal(t, []int64{1, 2}, unsent(t, o))
+
+		n, err := relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Empty(t, unsent(t, o))
+	})
+
+	t.Run("dead lettered messages are marked sent", func(t *testing.T) {
+		o := newTestOutbox(t)
+		producer := NewMockProducer(&Config{})
+		producer.FailNext(1, fmt.Errorf("%w: broker down", ErrDeadLettered))
+		writeOutbox(t, o, true, outboxMessages(2)...)
+
+		n, err := NewRelay(o, producer).RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Empty(t, unsent(t, o))
+	})
+
+	t.Run("cleanup removes the messages sent before the retention", func(t *testing.T) {
+		o := newTestOutbox(t)
+		writeOutbox(t, o, true, outboxMessages(3)...)
+		relay := NewRelay(o, NewMockProducer(&Config{}), WithRelayRetention(time.Hour))
+		_, err := relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		writeOutbox(t, o, true, outboxMessages(1)...)
+
+		_, err = o.db.Exec("UPDATE kafka_outbox SET sent_at = ? WHERE id = 1", time.Now().Add(-2*time.Hour).UnixMilli())
+		require.NoError(t, err)
+
+		n, err := relay.Cleanup(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+
+		var left int
+		require.NoError(t, o.db.QueryRow("SELECT COUNT(*) FROM kafka_outbox").Scan(&left))
+		assert.Equal(t, 3, left)
+		assert.Equal(t, []int64{4}, unsent(t, o))
+	})
+
+	t.Run("non-positive options keep the defaults", func(t *testing.T) {
+		o := newTestOutbox(t)
+		writeOutbox(t, o, true, outboxMessages(3)...)
+
+		for _, size := range []int{0, -1} {
+			relay := NewRelay(o, NewMockProducer(&Config{}), WithRelayBatchSize(size), WithRelayInterval(-time.Second))
+			assert.Equal(t, 100, relay.batchSize)
+			assert.Equal(t, time.Second, relay.interval)
+		}
+
+		n, err := NewRelay(o, NewMockProducer(&Config{}), WithRelayBatchSize(0)).RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+	})
+}
+
+func TestOutbox_Rebind(t *testing.T) {
+	q := "UPDATE %s SET sent_at = ? WHERE id IN (?, ?)"
+
+	o := NewOutbox(nil, DialectPostgres, "")
+	assert.Equal(t, "UPDATE kafka_outbox SET sent_at = $1 WHERE id IN ($2, $3)", o.rebind(q))
+
+	for _, d := range []Dialect{DialectMySQL, DialectSQLite} {
+		o = NewOutbox(nil, d, "events_outbox")
+		assert.Equal(t, "UPDATE events_outbox SET sent_at = ? WHERE id IN (?, ?)", o.rebind(q))
+	}
+}
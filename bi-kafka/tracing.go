@@ -0,0 +1,145 @@
+package bikafka
+
+import (
+	"context"
+
+	qtrace "github.com/clubpay/qlubkit-go/telemetry/trace"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentation = "github.com/clubpay/qlubkit-go/bi-kafka"
+	messagingSystem = "kafka"
+)
+
+// defaultPropagator propagates the W3C trace context and baggage
+var defaultPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// headerCarrier adapts the message headers to propagation.TextMapCarrier
+type headerCarrier struct {
+	headers *[]kafka.Header
+}
+
+var _ propagation.TextMapCarrier = headerCarrier{}
+
+func (c headerCarrier) Get(key string) string {
+	v, _ := headerValue(*c.headers, key)
+
+	return v
+}
+
+// Set replaces the header if it exists, so the messages produced again carry the
+// current trace context
+func (c headerCarrier) Set(key, value string) {
+	for i, h := range *c.headers {
+		if h.Key == key {
+			(*c.headers)[i].Value = []byte(value)
+
+			return
+		}
+	}
+	*c.headers = append(*c.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, len(*c.headers))
+	for i, h := range *c.headers {
+		keys[i] = h.Key
+	}
+
+	return keys
+}
+
+func (c *Config) propagator() propagation.TextMapPropagator {
+	if c.Propagator != nil {
+		return c.Propagator
+	}
+
+	return defaultPropagator
+}
+
+// startPublish starts the producer span of the messages and injects its context into
+// their headers
+func (p *Producer) startPublish(ctx context.Context, messages []*Message) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystem(messagingSystem),
+		semconv.MessagingOperationPublish,
+		semconv.MessagingKafkaClientID(p.config.ClientID),
+	}
+
+	// The span is named after the topic if all the messages go to the same topic.
+	topic := ""
+	for i, msg := range messages {
+		if msg == nil || (i > 0 && msg.Topic != topic) {
+			topic = ""
+
+			break
+		}
+		topic = msg.Topic
+	}
+	name := "publish"
+	if topic != "" {
+		name = topic + " publish"
+		attrs = append(attrs, semconv.MessagingDestinationName(topic))
+	}
+	if len(messages) == 1 && messages[0] != nil && len(messages[0].Key) > 0 {
+		attrs = append(attrs, semconv.MessagingKafkaMessageKey(string(messages[0].Key)))
+	} else if len(messages) > 1 {
+		attrs = append(attrs, semconv.MessagingBatchMessageCount(len(messages)))
+	}
+
+	ctx, span := qtrace.NewSpan(
+		instrumentation, name, ctx,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attrs...),
+	)
+
+	propagator := p.config.propagator()
+	for _, msg := range messages {
+		if msg != nil {
+			propagator.Inject(ctx, headerCarrier{headers: &msg.Headers})
+		}
+	}
+
+	return ctx, span
+}
+
+// endSpan records the error, if any, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		qtrace.Error(span, err)
+	}
+	span.End()
+}
+
+// startProcess continues the trace of the message from its headers and starts the
+// consumer span of handling it
+func (c *Consumer) startProcess(ctx context.Context, msg *Message) (context.Context, trace.Span) {
+	ctx = c.config.propagator().Extract(ctx, headerCarrier{headers: &msg.Headers})
+
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystem(messagingSystem),
+		semconv.MessagingOperationProcess,
+		semconv.MessagingSourceName(msg.Topic),
+		semconv.MessagingKafkaSourcePartition(msg.Partition),
+		semconv.MessagingKafkaMessageOffsetKey.Int64(msg.Offset),
+		semconv.MessagingKafkaConsumerGroup(c.config.GroupID),
+	}
+	if len(msg.Key) > 0 {
+		attrs = append(attrs, semconv.MessagingKafkaMessageKey(string(msg.Key)))
+	}
+	if msg.Version != "" {
+		attrs = append(attrs, attribute.String("messaging.kafka.message.version", msg.Version))
+	}
+
+	return qtrace.NewSpan(
+		instrumentation, msg.Topic+" process", ctx,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...),
+	)
+}
@@ -0,0 +1,108 @@
+package bikafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider recording the spans for the test
+func recordSpans(t *testing.T) (*tracetest.SpanRecorder, trace.Tracer) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	return recorder, tp.Tracer("test")
+}
+
+func TestHeaderCarrier(t *testing.T) {
+	headers := []kafka.Header{{Key: "traceparent", Value: []byte("old")}, {Key: "source", Value: []byte("pos")}}
+	carrier := headerCarrier{headers: &headers}
+
+	carrier.Set("traceparent", "new")
+	carrier.Set("tracestate", "state")
+	assert.Equal(t, "new", carrier.Get("traceparent"))
+	assert.Equal(t, "", carrier.Get("baggage"))
+	assert.Equal(t, []string{"traceparent", "source", "tracestate"}, carrier.Keys())
+}
+
+func TestProducer_TracePropagation(t *testing.T) {
+	recorder, tracer := recordSpans(t)
+	p := unreachableProducer(t)
+
+	member, err := baggage.NewMember("restaurant", "r1")
+	require.NoError(t, err)
+	bag, err := baggage.New(member)
+	require.NoError(t, err)
+	ctx := baggage.ContextWithBaggage(context.Background(), bag)
+	ctx, parent := tracer.Start(ctx, "request")
+
+	msg := &Message{Topic: "orders", Key: []byte("o1")}
+	assert.Error(t, p.Produce(ctx, msg))
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	span := spans[0]
+	assert.Equal(t, "orders publish", span.Name())
+	assert.Equal(t, trace.SpanKindProducer, span.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Contains(t, span.Attributes(), attribute.String("messaging.system", "kafka"))
+	assert.Contains(t, span.Attributes(), attribute.String("messaging.destination.name", "orders"))
+	assert.Contains(t, span.Attributes(), attribute.String("messaging.kafka.message.key", "o1"))
+
+	// The headers carry the context of the producer span.
+	traceparent := header(t, msg.Headers, "traceparent")
+	assert.Contains(t, traceparent, span.SpanContext().TraceID().String())
+	assert.Contains(t, traceparent, span.SpanContext().SpanID().String())
+	assert.Equal(t, "restaurant=r1", header(t, msg.Headers, "baggage"))
+}
+
+func TestConsumer_TracePropagation(t *testing.T) {
+	recorder, tracer := recordSpans(t)
+
+	// The producer side injects the context into the headers.
+	var headers []kafka.Header
+	ctx, producerSpan := tracer.Start(context.Background(), "orders publish")
+	defaultPropagator.Inject(ctx, headerCarrier{headers: &headers})
+	producerSpan.End()
+
+	m := testMessages(0, 0, 0)[0]
+	m.Headers = append(m.Headers, headers...)
+	r := newFakeReader(m)
+
+	var handlerSpan trace.SpanContext
+	c := newConsumer(r, func(ctx context.Context, _ *Message) error {
+		handlerSpan = trace.SpanContextFromContext(ctx)
+
+		return nil
+	}, &Config{GroupID: "bi"})
+
+	err := runUntil(t, c, func() bool { return len(r.committed()) == 1 })
+	assert.NoError(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	span := spans[1]
+	assert.Equal(t, "test-topic process", span.Name())
+	assert.Equal(t, trace.SpanKindConsumer, span.SpanKind())
+	assert.Equal(t, producerSpan.SpanContext().TraceID(), span.SpanContext().TraceID())
+	assert.Equal(t, producerSpan.SpanContext().SpanID(), span.Parent().SpanID())
+	assert.Equal(t, span.SpanContext().SpanID(), handlerSpan.SpanID())
+	assert.Contains(t, span.Attributes(), attribute.String("messaging.kafka.consumer.group", "bi"))
+	assert.Contains(t, span.Attributes(), attribute.Int64("messaging.kafka.message.offset", 0))
+}
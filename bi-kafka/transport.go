@@ -0,0 +1,124 @@
+package bikafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// SASLMechanism is the SASL mechanism used to authenticate with the brokers
+type SASLMechanism string
+
+const (
+	SASLPlain       SASLMechanism = "PLAIN"
+	SASLScramSHA256 SASLMechanism = "SCRAM-SHA-256"
+	SASLScramSHA512 SASLMechanism = "SCRAM-SHA-512"
+)
+
+// saslMechanism returns the SASL mechanism of the config, or nil if no credentials
+// are set
+func (c *Config) saslMechanism() (sasl.Mechanism, error) {
+	if c.Username == "" && c.Password == "" {
+		return nil, nil
+	}
+
+	switch c.SASLMechanism {
+	case "", SASLPlain:
+		return plain.Mechanism{
+			Username: c.Username,
+			Password: c.Password,
+		}, nil
+	case SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, c.Username, c.Password)
+	case SASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, c.Username, c.Password)
+	}
+
+	return nil, fmt.Errorf("unsupported SASL mechanism %q", c.SASLMechanism)
+}
+
+// tlsConfig returns the TLS config of the config, or nil if TLS is disabled. Setting
+// the CA or the client certificate file enables TLS. TLSConfig takes precedence over
+// the files.
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	if c.TLSConfig != nil {
+		return c.TLSConfig.Clone(), nil
+	}
+	if !c.EnableTLS && c.CAFile == "" && c.CertFile == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// newTransport creates the transport used to connect to the brokers
+func (c *Config) newTransport() (*kafka.Transport, error) {
+	mechanism, err := c.saslMechanism()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Transport{
+		ClientID:    c.ClientID,
+		DialTimeout: c.Timeout,
+		SASL:        mechanism,
+		TLS:         tlsConfig,
+	}, nil
+}
+
+// newDialer creates the dialer used by the consumer to connect to the brokers
+func (c *Config) newDialer() (*kafka.Dialer, error) {
+	mechanism, err := c.saslMechanism()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Dialer{
+		ClientID:      c.ClientID,
+		Timeout:       c.Timeout,
+		DualStack:     true,
+		SASLMechanism: mechanism,
+		TLS:           tlsConfig,
+	}, nil
+}
@@ -0,0 +1,152 @@
+package bikafka
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCertFiles writes a self-signed certificate and its key as PEM files
+func writeCertFiles(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "bi-kafka-test"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certFile, keyFile
+}
+
+func transportOf(t *testing.T, p *Producer) *kafka.Transport {
+	transport, ok := p.writer.Transport.(*kafka.Transport)
+	require.True(t, ok)
+
+	return transport
+}
+
+func TestNewProducer_WriterConfig(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		p, err := NewProducerWithOptions(WithBootstrapServers("localhost:9092"))
+		require.NoError(t, err)
+
+		assert.Equal(t, kafka.RequireOne, p.writer.RequiredAcks)
+		assert.Equal(t, kafka.Compression(0), p.writer.Compression)
+		assert.Equal(t, int64(0), p.writer.BatchBytes)
+
+		transport := transportOf(t, p)
+		assert.Equal(t, "bi-kafka-producer", transport.ClientID)
+		assert.Nil(t, transport.SASL)
+		assert.Nil(t, transport.TLS)
+	})
+
+	t.Run("compression, acks, client ID and max message bytes", func(t *testing.T) {
+		p, err := NewProducerWithOptions(
+			WithBootstrapServers("localhost:9092"),
+			WithZstdCompression(),
+			WithWaitForAll(),
+			WithClientID("my-app"),
+			WithMaxMessageBytes(1<<20),
+		)
+		require.NoError(t, err)
+
+		assert.Equal(t, kafka.Zstd, p.writer.Compression)
+		assert.Equal(t, kafka.RequireAll, p.writer.RequiredAcks)
+		assert.Equal(t, int64(1<<20), p.writer.BatchBytes)
+		assert.Equal(t, "my-app", transportOf(t, p).ClientID)
+	})
+
+	t.Run("no response is not overridden by the default", func(t *testing.T) {
+		p, err := NewProducerWithOptions(WithBootstrapServers("localhost:9092"), WithNoResponse())
+		require.NoError(t, err)
+
+		assert.Equal(t, kafka.RequireNone, p.writer.RequiredAcks)
+	})
+
+	t.Run("SASL mechanisms", func(t *testing.T) {
+		tests := []struct {
+			option Option
+			name   string
+		}{
+			{WithSASL("user", "pass"), "PLAIN"},
+			{WithSCRAM(SASLScramSHA256, "user", "pass"), "SCRAM-SHA-256"},
+			{WithSCRAM(SASLScramSHA512, "user", "pass"), "SCRAM-SHA-512"},
+		}
+		for _, tt := range tests {
+			p, err := NewProducerWithOptions(WithBootstrapServers("localhost:9092"), tt.option)
+			require.NoError(t, err)
+
+			transport := transportOf(t, p)
+			require.NotNil(t, transport.SASL)
+			assert.Equal(t, tt.name, transport.SASL.Name())
+		}
+	})
+
+	t.Run("unsupported SASL mechanism", func(t *testing.T) {
+		_, err := NewProducerWithOptions(
+			WithBootstrapServers("localhost:9092"),
+			WithSCRAM("SCRAM-MD5", "user", "pass"),
+		)
+		assert.ErrorContains(t, err, "unsupported SASL mechanism")
+	})
+
+	t.Run("TLS", func(t *testing.T) {
+		p, err := NewProducerWithOptions(WithBootstrapServers("localhost:9092"), WithTLS())
+		require.NoError(t, err)
+		assert.NotNil(t, transportOf(t, p).TLS)
+
+		custom := &tls.Config{ServerName: "kafka.internal", MinVersion: tls.VersionTLS13}
+		p, err = NewProducerWithOptions(WithBootstrapServers("localhost:9092"), WithTLSConfig(custom))
+		require.NoError(t, err)
+		assert.Equal(t, "kafka.internal", transportOf(t, p).TLS.ServerName)
+	})
+
+	t.Run("TLS files", func(t *testing.T) {
+		certFile, keyFile := writeCertFiles(t)
+
+		p, err := NewProducerWithOptions(
+			WithBootstrapServers("localhost:9092"),
+			WithTLSFiles(certFile, certFile, keyFile),
+		)
+		require.NoError(t, err)
+
+		tlsConfig := transportOf(t, p).TLS
+		require.NotNil(t, tlsConfig)
+		assert.NotNil(t, tlsConfig.RootCAs)
+		assert.Len(t, tlsConfig.Certificates, 1)
+
+		_, err = NewProducerWithOptions(
+			WithBootstrapServers("localhost:9092"),
+			WithTLSFiles(filepath.Join(t.TempDir(), "missing.pem"), "", ""),
+		)
+		assert.ErrorContains(t, err, "failed to read CA file")
+	})
+}
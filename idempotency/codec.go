@@ -0,0 +1,267 @@
+package idempotency
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec converts Data to the bytes kept in the store and vice versa.
+type Codec interface {
+	Encode(data *Data) ([]byte, error)
+	Decode(raw []byte, data *Data) error
+}
+
+var (
+	// JSONCodec encodes Data as JSON. This is the default codec.
+	JSONCodec Codec = jsonCodec{}
+	// BinaryCodec encodes Data in a compact length-prefixed binary format, so the
+	// body is not base64 inflated. It can decode the records written by JSONCodec.
+	BinaryCodec Codec = binaryCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(data *Data) ([]byte, error) {
+	return json.Marshal(data)
+}
+
+func (jsonCodec) Decode(raw []byte, data *Data) error {
+	return json.Unmarshal(raw, data)
+}
+
+const (
+	binaryMagic     byte = 0xB1
+	binaryTruncated byte = 1 << 0
+)
+
+var errCorruptedData = errors.New("corrupted idempotency data")
+
+type binaryCodec struct{}
+
+func (binaryCodec) Encode(data *Data) ([]byte, error) {
+	b := make([]byte, 0, len(data.Body)+len(data.Fingerprint)+64)
+	b = append(b, binaryMagic)
+	var flags byte
+	if data.Truncated {
+		flags |= binaryTruncated
+	}
+	b = append(b, flags)
+	b = binary.AppendVarint(b, int64(data.Status))
+	b = appendBytes(b, data.Body)
+	b = appendBytes(b, []byte(data.Fingerprint))
+	b = binary.AppendUvarint(b, uint64(len(data.Header)))
+	for k, v := range data.Header {
+		b = appendBytes(b, []byte(k))
+		b = appendBytes(b, []byte(v))
+	}
+	b = binary.AppendUvarint(b, uint64(len(data.Headers)))
+	for k, vv := range data.Headers {
+		b = appendBytes(b, []byte(k))
+		b = binary.AppendUvarint(b, uint64(len(vv)))
+		for _, v := range vv {
+			b = appendBytes(b, []byte(v))
+		}
+	}
+
+	return b, nil
+}
+
+func (binaryCodec) Decode(raw []byte, data *Data) error {
+	if len(raw) == 0 || raw[0] != binaryMagic {
+		return JSONCodec.Decode(raw, data)
+	}
+
+	r := &binaryReader{b: raw[1:]}
+	flags := r.byte()
+	data.Truncated = flags&binaryTruncated != 0
+	data.Status = int(r.varint())
+	data.Body = r.bytes()
+	data.Fingerprint = string(r.bytes())
+	if n := r.uvarint(); n > 0 {
+		data.Header = make(map[string]string, min(n, uint64(len(r.b))))
+		for ; n > 0 && r.err == nil; n-- {
+			k := string(r.bytes())
+			data.Header[k] = string(r.bytes())
+		}
+	}
+	if n := r.uvarint(); n > 0 {
+		data.Headers = make(http.Header, min(n, uint64(len(r.b))))
+		for ; n > 0 && r.err == nil; n-- {
+			k := string(r.bytes())
+			for m := r.uvarint(); m > 0 && r.err == nil; m-- {
+				data.Headers[k] = append(data.Headers[k], string(r.bytes()))
+			}
+		}
+	}
+
+	return r.err
+}
+
+func appendBytes(b, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(v)))
+
+	return append(b, v...)
+}
+
+type binaryReader struct {
+	b   []byte
+	err error
+}
+
+func (r *binaryReader) byte() byte {
+	if r.err != nil || len(r.b) == 0 {
+		r.err = errCorruptedData
+
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+
+	return v
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = errCorruptedData
+
+		return 0
+	}
+	r.b = r.b[n:]
+
+	return v
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.b)
+	if n <= 0 {
+		r.err = errCorruptedData
+
+		return 0
+	}
+	r.b = r.b[n:]
+
+	return v
+}
+
+func (r *binaryReader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.b)) {
+		r.err = errCorruptedData
+
+		return nil
+	}
+	v := r.b[:n:n]
+	r.b = r.b[n:]
+
+	return v
+}
+
+// GzipCodec compresses the output of c with gzip. Records which are not compressed
+// are passed to c as they are, so it is safe to enable it on an existing store.
+func GzipCodec(c Codec) Codec {
+	return gzipCodec{c: c}
+}
+
+type gzipCodec struct {
+	c Codec
+}
+
+func (g gzipCodec) Encode(data *Data) ([]byte, error) {
+	raw, err := g.c.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	if _, err = w.Write(raw); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (g gzipCodec) Decode(raw []byte, data *Data) error {
+	if !bytes.HasPrefix(raw, []byte{0x1f, 0x8b}) {
+		return g.c.Decode(raw, data)
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	raw, err = io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return g.c.Decode(raw, data)
+}
+
+// ZstdCodec compresses the output of c with zstd. Records which are not compressed
+// are passed to c as they are, so it is safe to enable it on an existing store.
+func ZstdCodec(c Codec) Codec {
+	return zstdCodec{c: c}
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func initZstd() {
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+}
+
+type zstdCodec struct {
+	c Codec
+}
+
+func (z zstdCodec) Encode(data *Data) ([]byte, error) {
+	raw, err := z.c.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+	zstdOnce.Do(initZstd)
+
+	return zstdEncoder.EncodeAll(raw, nil), nil
+}
+
+func (z zstdCodec) Decode(raw []byte, data *Data) error {
+	if !bytes.HasPrefix(raw, []byte{0x28, 0xb5, 0x2f, 0xfd}) {
+		return z.c.Decode(raw, data)
+	}
+	zstdOnce.Do(initZstd)
+
+	raw, err := zstdDecoder.DecodeAll(raw, nil)
+	if err != nil {
+		return err
+	}
+
+	return z.c.Decode(raw, data)
+}
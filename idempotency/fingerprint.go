@@ -0,0 +1,60 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// FingerprintFunc calculates a canonical hash of a request. Two requests that are
+// considered the same must have the same fingerprint.
+type FingerprintFunc func(method, path string, body []byte) (string, error)
+
+// DefaultFingerprint hashes method, path and the raw body.
+func DefaultFingerprint(method, path string, body []byte) (string, error) {
+	return hashRequest(method, path, body), nil
+}
+
+// JSONFingerprint hashes method, path and the canonical form of the JSON body, hence
+// field ordering and whitespaces do not change the fingerprint. If body is not a valid
+// JSON it falls back to the raw body.
+func JSONFingerprint(method, path string, body []byte) (string, error) {
+	return hashRequest(method, path, canonicalJSON(body)), nil
+}
+
+func canonicalJSON(body []byte) []byte {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return body
+	}
+
+	// encoding/json sorts the map keys, so the output does not depend on field ordering.
+	out, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+
+	return out
+}
+
+func hashRequest(method, path string, body []byte) string {
+	h := sha256.New()
+	for _, part := range [][]byte{[]byte(strings.ToUpper(method)), []byte(path), body} {
+		var l [8]byte
+		binary.BigEndian.PutUint64(l[:], uint64(len(part)))
+		h.Write(l[:])
+		h.Write(part)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -1,63 +1,148 @@
 package idempotency
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/http"
 	"time"
 
 	"github.com/clubpay/qlubkit-go/idempotency/store"
+	"github.com/clubpay/qlubkit-go/telemetry/log"
 	"golang.org/x/sync/singleflight"
 )
 
 const (
-	defaultTTL = 24 * time.Hour
+	defaultTTL     = 24 * time.Hour
+	defaultLockTTL = 30 * time.Second
+	// defaultMaxRequestSize is the largest request body Middleware reads.
+	defaultMaxRequestSize = 1 << 20
 )
 
+// ErrFingerprintMismatch is returned when an idempotency key is replayed with a
+// request which is different from the one that created it.
+var ErrFingerprintMismatch = errors.New("idempotency key reused with a different request")
+
+// ErrInProgress is returned by Process and Lock if the key is being processed by another caller.
+var ErrInProgress = errors.New("idempotency key is being processed")
+
+// ErrBodyTooLarge is returned by Set if the body is larger than the size given by
+// WithMaxBodySize and the policy is RejectBody.
+var ErrBodyTooLarge = errors.New("idempotency body is too large")
+
+// ErrTruncated is returned if the stored data has been truncated because of
+// WithMaxBodySize, hence it cannot be replayed.
+var ErrTruncated = errors.New("idempotency data is truncated")
+
 type Data struct {
-	Status int               `json:"status"`
-	Body   []byte            `json:"body"`
-	Header map[string]string `json:"hdr"`
+	Status int    `json:"status"`
+	Body   []byte `json:"body"`
+	// Header keeps a single value per header, use Headers to keep repeated headers.
+	Header      map[string]string `json:"hdr"`
+	Headers     http.Header       `json:"hdrs,omitempty"`
+	Fingerprint string            `json:"fp,omitempty"`
+	// Truncated is set if the body has been truncated because of WithMaxBodySize.
+	Truncated bool `json:"trunc,omitempty"`
+}
+
+// HTTPHeader returns all the headers of the data, Headers take precedence over Header.
+func (d *Data) HTTPHeader() http.Header {
+	hdr := make(http.Header, len(d.Header)+len(d.Headers))
+	for k, v := range d.Header {
+		hdr.Set(k, v)
+	}
+	for k, vv := range d.Headers {
+		hdr[http.CanonicalHeaderKey(k)] = append([]string(nil), vv...)
+	}
+	return hdr
 }
 
+// BodyPolicy decides what happens to the bodies larger than the size given by WithMaxBodySize.
+type BodyPolicy int
+
+const (
+	// TruncateBody stores the first bytes of the body and sets Data.Truncated.
+	TruncateBody BodyPolicy = iota
+	// DropBody stores the data without body and sets Data.Truncated.
+	DropBody
+	// RejectBody does not store the data and Set returns ErrBodyTooLarge.
+	RejectBody
+)
+
 type Idempotency struct {
-	ttl   time.Duration
-	store store.Store
+	ttl         time.Duration
+	store       store.Store
+	fingerprint FingerprintFunc
+	namespace   string
+	codec       Codec
+	maxBodySize int
+	bodyPolicy  BodyPolicy
+	lockTTL     time.Duration
+	maxReqSize  int64
+	logger      *log.Logger
+	sf          singleflight.Group
 }
 
-var sf singleflight.Group
+// singleflight keys are prefixed by the operation, so concurrent calls are only
+// merged with calls of the same operation.
+const (
+	sfGet     = "get:"
+	sfProcess = "process:"
+)
 
 type Option func(*Idempotency)
 
 func New(opts ...Option) *Idempotency {
-	idm := &Idempotency{}
+	idm := &Idempotency{
+		fingerprint: DefaultFingerprint,
+		codec:       JSONCodec,
+		maxReqSize:  defaultMaxRequestSize,
+		logger:      log.DefaultLogger,
+	}
 	for _, opt := range opts {
 		opt(idm)
 	}
 	// After Options
-	ttl := defaultTTL
-	if idm.ttl != time.Duration(0) {
-		ttl = idm.ttl
+	if idm.ttl == time.Duration(0) {
+		idm.ttl = defaultTTL
+	}
+	if idm.lockTTL == time.Duration(0) {
+		idm.lockTTL = defaultLockTTL
 	}
-	idm.store.SetTTL(ttl)
 	return idm
 }
 
-// Set the data related with the key
-func (i *Idempotency) Set(key string, data *Data) error {
-	rawData, err := json.Marshal(data)
+// Set the data related with the key. If ttl is zero, the ttl given by WithTTL is used.
+func (i *Idempotency) Set(ctx context.Context, key string, data *Data, ttl time.Duration) error {
+	if i.maxBodySize > 0 && len(data.Body) > i.maxBodySize {
+		limited := *data
+		switch i.bodyPolicy {
+		case RejectBody:
+			return ErrBodyTooLarge
+		case DropBody:
+			limited.Body = nil
+		default:
+			limited.Body = data.Body[:i.maxBodySize]
+		}
+		limited.Truncated = true
+		data = &limited
+	}
+	rawData, err := i.codec.Encode(data)
 	if err != nil {
 		return err
 	}
-	_, sfErr, _ := sf.Do(key, func() (interface{}, error) {
-		errSetValue := i.store.SetValue(key, rawData)
-		return nil, errSetValue
-	})
-	return sfErr
+	if ttl <= 0 {
+		ttl = i.ttl
+	}
+	// Writes are not merged, since concurrent calls may carry different data.
+	return i.store.Set(ctx, i.storeKey(key), rawData, ttl)
 }
 
 // Check if idempotent and returns the data related with the key
-func (i *Idempotency) Check(key string) (*Data, error) {
-	sfV, sfErr, _ := sf.Do(key, func() (interface{}, error) {
-		return i.store.GetValue(key)
+func (i *Idempotency) Check(ctx context.Context, key string) (*Data, error) {
+	key = i.storeKey(key)
+	sfV, sfErr, _ := i.sf.Do(sfGet+key, func() (interface{}, error) {
+		return i.store.Get(ctx, key)
 	})
 	if sfErr != nil {
 		return nil, sfErr
@@ -67,9 +152,115 @@ func (i *Idempotency) Check(key string) (*Data, error) {
 		return nil, nil
 	}
 	data := &Data{}
-	err := json.Unmarshal(rawData, data)
+	err := i.codec.Decode(rawData, data)
 	if err != nil {
 		return nil, err
 	}
 	return data, nil
 }
+
+// CheckRequest works like Check, but it also makes sure the stored data was created
+// by a request with the same fingerprint. It returns ErrFingerprintMismatch if the
+// key has been used by a different request. Data stored without fingerprint is
+// accepted for any request.
+func (i *Idempotency) CheckRequest(ctx context.Context, key, fingerprint string) (*Data, error) {
+	data, err := i.Check(ctx, key)
+	if err != nil || data == nil {
+		return data, err
+	}
+	if data.Fingerprint != "" && data.Fingerprint != fingerprint {
+		return nil, ErrFingerprintMismatch
+	}
+	return data, nil
+}
+
+// Fingerprint returns the fingerprint of the request using the configured FingerprintFunc.
+func (i *Idempotency) Fingerprint(method, path string, body []byte) (string, error) {
+	return i.fingerprint(method, path, body)
+}
+
+// Process runs fn only once for the key and returns its output. Later calls with the
+// same key return the stored output without calling fn. While fn is running, the key
+// is locked in the store for the duration given by WithLockTTL and other callers get
+// ErrInProgress, hence it can be used to dedupe the messages of consumers running on
+// multiple replicas. The output is not stored if fn returns an error, so it can be
+// retried. If storing the output fails, the output is returned along with the error.
+// If the stored output has been truncated, ErrTruncated is returned.
+func (i *Idempotency) Process(ctx context.Context, key string, fn func() ([]byte, error)) ([]byte, error) {
+	data, err := i.Check(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		return storedBody(data)
+	}
+
+	sfV, sfErr, _ := i.sf.Do(sfProcess+i.storeKey(key), func() (interface{}, error) {
+		unlock, err := i.Lock(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+
+		// The key may have been processed by another caller before we took the lock.
+		data, err := i.Check(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if data != nil {
+			return storedBody(data)
+		}
+
+		body, err := fn()
+		if err != nil {
+			return nil, err
+		}
+
+		return body, i.Set(ctx, key, &Data{Body: body}, 0)
+	})
+	body, _ := sfV.([]byte)
+
+	return body, sfErr
+}
+
+// storedBody returns the body of data, or ErrTruncated if it is not complete.
+// Lock takes the in-flight lock of the key, so concurrent calls with the same key are
+// not processed twice. It returns ErrInProgress if the lock is held by another caller.
+// The returned function releases the lock, unless it has expired and been taken by
+// another caller.
+func (i *Idempotency) Lock(ctx context.Context, key string) (unlock func(), err error) {
+	lockKey := i.storeKey(key) + ":lock"
+	token := make([]byte, 16)
+	_, _ = rand.Read(token)
+	ok, err := i.store.SetNX(ctx, lockKey, token, i.lockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInProgress
+	}
+
+	return func() {
+		_, _ = store.CompareAndDelete(context.WithoutCancel(ctx), i.store, lockKey, token)
+	}, nil
+}
+
+// Logger returns the logger which reports the store errors.
+func (i *Idempotency) Logger() *log.Logger {
+	return i.logger
+}
+
+func storedBody(data *Data) ([]byte, error) {
+	if data.Truncated {
+		return nil, ErrTruncated
+	}
+	return data.Body, nil
+}
+
+// storeKey returns the key in the store, which is prefixed by the namespace if set.
+func (i *Idempotency) storeKey(key string) string {
+	if i.namespace == "" {
+		return key
+	}
+	return i.namespace + ":" + key
+}
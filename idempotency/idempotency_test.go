@@ -1,7 +1,15 @@
 package idempotency_test
 
 import (
+	"context"
+	"errors"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -18,22 +26,23 @@ func TestIdempotencyCheck(t *testing.T) {
 			Body:   []byte("{\"Result\":\"Payment Received.\"}"),
 			Header: map[string]string{"hdrKey1": "Value1", "hdrKey2": "Value2"},
 		}
+		ctx := context.Background()
 		backendStore := store.NewRistretto()
 		key := "asd"
 		idm := idempotency.New(
 			idempotency.WithStore(backendStore),
 			idempotency.WithTTL(1*time.Minute),
 		)
-		res, err := idm.Check(key)
+		res, err := idm.Check(ctx, key)
 		c.So(res, ShouldBeNil)
 		c.So(err, ShouldBeNil)
-		err = idm.Set(key, &data)
+		err = idm.Set(ctx, key, &data, 0)
 		c.So(err, ShouldBeNil)
 		idm = idempotency.New(
 			idempotency.WithStore(backendStore),
 			idempotency.WithTTL(1*time.Minute),
 		)
-		res, err = idm.Check(key)
+		res, err = idm.Check(ctx, key)
 		c.So(res, ShouldNotBeNil)
 		c.So(err, ShouldBeNil)
 		c.So(res.Body, ShouldResemble, data.Body)
@@ -41,3 +50,522 @@ func TestIdempotencyCheck(t *testing.T) {
 		c.So(res.Header, ShouldResemble, data.Header)
 	})
 }
+
+func TestIdempotencyFingerprint(t *testing.T) {
+	Convey("Idempotency fingerprint", t, func(c C) {
+		Convey("JSON fingerprint ignores field ordering", func(c C) {
+			fp1, err := idempotency.JSONFingerprint(http.MethodPost, "/pay", []byte(`{"a":1,"b":{"c":"x","d":2.50}}`))
+			c.So(err, ShouldBeNil)
+			fp2, err := idempotency.JSONFingerprint(http.MethodPost, "/pay", []byte(`{ "b": {"d":2.50, "c":"x"}, "a": 1 }`))
+			c.So(err, ShouldBeNil)
+			c.So(fp1, ShouldEqual, fp2)
+			fp3, err := idempotency.JSONFingerprint(http.MethodPost, "/pay", []byte(`{"a":2,"b":{"c":"x","d":2.50}}`))
+			c.So(err, ShouldBeNil)
+			c.So(fp1, ShouldNotEqual, fp3)
+			fp4, err := idempotency.JSONFingerprint(http.MethodPost, "/refund", []byte(`{"a":1,"b":{"c":"x","d":2.50}}`))
+			c.So(err, ShouldBeNil)
+			c.So(fp1, ShouldNotEqual, fp4)
+		})
+
+		Convey("Default fingerprint uses the raw body", func(c C) {
+			fp1, err := idempotency.DefaultFingerprint(http.MethodPost, "/pay", []byte(`{"a":1,"b":2}`))
+			c.So(err, ShouldBeNil)
+			fp2, err := idempotency.DefaultFingerprint(http.MethodPost, "/pay", []byte(`{"b":2,"a":1}`))
+			c.So(err, ShouldBeNil)
+			c.So(fp1, ShouldNotEqual, fp2)
+		})
+
+		Convey("Mismatched replay is rejected", func(c C) {
+			ctx := context.Background()
+			idm := idempotency.New(
+				idempotency.WithStore(store.NewRistretto()),
+				idempotency.WithFingerprint(idempotency.JSONFingerprint),
+			)
+			fp, _ := idm.Fingerprint(http.MethodPost, "/pay", []byte(`{"amount":10}`))
+			err := idm.Set(ctx, "k1", &idempotency.Data{Status: http.StatusOK, Fingerprint: fp}, 0)
+			c.So(err, ShouldBeNil)
+
+			res, err := idm.CheckRequest(ctx, "k1", fp)
+			c.So(err, ShouldBeNil)
+			c.So(res, ShouldNotBeNil)
+
+			otherFP, _ := idm.Fingerprint(http.MethodPost, "/pay", []byte(`{"amount":20}`))
+			res, err = idm.CheckRequest(ctx, "k1", otherFP)
+			c.So(err, ShouldEqual, idempotency.ErrFingerprintMismatch)
+			c.So(res, ShouldBeNil)
+		})
+	})
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	Convey("Idempotency middleware", t, func(c C) {
+		calls := 0
+		h := idempotency.Middleware(
+			idempotency.New(
+				idempotency.WithStore(store.NewRistretto()),
+				idempotency.WithFingerprint(idempotency.JSONFingerprint),
+			),
+		)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("X-Call", strconv.Itoa(calls))
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.Copy(w, r.Body)
+		}))
+
+		do := func(key, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/pay", strings.NewReader(body))
+			if key != "" {
+				req.Header.Set(idempotency.HeaderKey, key)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			return rec
+		}
+
+		rec := do("key1", `{"amount":10,"currency":"AED"}`)
+		c.So(rec.Code, ShouldEqual, http.StatusCreated)
+		c.So(calls, ShouldEqual, 1)
+
+		rec = do("key1", `{"currency":"AED","amount":10}`)
+		c.So(rec.Code, ShouldEqual, http.StatusCreated)
+		c.So(rec.Header().Get("X-Call"), ShouldEqual, "1")
+		c.So(rec.Body.String(), ShouldEqual, `{"amount":10,"currency":"AED"}`)
+		c.So(calls, ShouldEqual, 1)
+
+		rec = do("key1", `{"amount":20,"currency":"AED"}`)
+		c.So(rec.Code, ShouldEqual, http.StatusUnprocessableEntity)
+		c.So(calls, ShouldEqual, 1)
+
+		rec = do("", `{"amount":20,"currency":"AED"}`)
+		c.So(rec.Code, ShouldEqual, http.StatusCreated)
+		c.So(calls, ShouldEqual, 2)
+	})
+}
+
+// failingStore fails all the calls with err.
+type failingStore struct {
+	store.Store
+	err error
+}
+
+func (s failingStore) Get(context.Context, string) ([]byte, error) {
+	return nil, s.err
+}
+
+// ctxStore fails Set calls once their context is done.
+type ctxStore struct {
+	store.Store
+}
+
+func (s ctxStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.Store.Set(ctx, key, value, ttl)
+}
+
+func TestIdempotencyMiddlewareErrors(t *testing.T) {
+	Convey("Idempotency middleware errors", t, func(c C) {
+		calls := 0
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+		})
+		do := func(idm *idempotency.Idempotency, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/pay", strings.NewReader(body))
+			req.Header.Set(idempotency.HeaderKey, "key1")
+			rec := httptest.NewRecorder()
+			idempotency.Middleware(idm)(next).ServeHTTP(rec, req)
+
+			return rec
+		}
+
+		Convey("Large requests are rejected", func(c C) {
+			idm := idempotency.New(
+				idempotency.WithStore(store.NewRistretto()),
+				idempotency.WithMaxRequestSize(4),
+			)
+			rec := do(idm, "12345")
+			c.So(rec.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			c.So(calls, ShouldEqual, 0)
+
+			rec = do(idm, "1234")
+			c.So(rec.Code, ShouldEqual, http.StatusOK)
+			c.So(calls, ShouldEqual, 1)
+		})
+
+		Convey("Store errors are not exposed", func(c C) {
+			idm := idempotency.New(
+				idempotency.WithStore(failingStore{Store: store.NewRistretto(), err: errors.New("redis: secret-host:6379 refused")}),
+			)
+			rec := do(idm, "{}")
+			c.So(rec.Code, ShouldEqual, http.StatusInternalServerError)
+			c.So(rec.Body.String(), ShouldNotContainSubstring, "secret-host")
+			c.So(calls, ShouldEqual, 0)
+		})
+
+		Convey("Responses are stored after the client has gone away", func(c C) {
+			idm := idempotency.New(idempotency.WithStore(ctxStore{Store: store.NewRistretto()}))
+			ctx, cancel := context.WithCancel(context.Background())
+			req := httptest.NewRequest(http.MethodPost, "/pay", strings.NewReader("{}")).WithContext(ctx)
+			req.Header.Set(idempotency.HeaderKey, "key1")
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				cancel()
+			})
+			idempotency.Middleware(idm)(h).ServeHTTP(httptest.NewRecorder(), req)
+			c.So(calls, ShouldEqual, 1)
+
+			data, err := idm.Check(context.Background(), "key1")
+			c.So(err, ShouldBeNil)
+			c.So(data, ShouldNotBeNil)
+			c.So(data.Status, ShouldEqual, http.StatusOK)
+		})
+	})
+}
+
+// blockingStore blocks Get calls until release is closed.
+type blockingStore struct {
+	store.Store
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.entered <- struct{}{}
+	<-s.release
+
+	return s.Store.Get(ctx, key)
+}
+
+// slowSetStore blocks Set calls until release is closed.
+type slowSetStore struct {
+	store.Store
+	calls   atomic.Int32
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *slowSetStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.calls.Add(1)
+	s.entered <- struct{}{}
+	<-s.release
+
+	return s.Store.Set(ctx, key, value, ttl)
+}
+
+func TestIdempotencyConcurrency(t *testing.T) {
+	Convey("Idempotency concurrent Check and Set", t, func(c C) {
+		ctx := context.Background()
+		bs := &blockingStore{
+			Store:   store.NewRistretto(),
+			entered: make(chan struct{}, 1),
+			release: make(chan struct{}),
+		}
+		idm := idempotency.New(idempotency.WithStore(bs))
+
+		var (
+			wg       sync.WaitGroup
+			checkRes *idempotency.Data
+			checkErr error
+		)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkRes, checkErr = idm.Check(ctx, "key")
+		}()
+		<-bs.entered
+
+		// Set must not be merged into the in-flight Check.
+		err := idm.Set(ctx, "key", &idempotency.Data{Status: http.StatusOK, Body: []byte("ok")}, 0)
+		c.So(err, ShouldBeNil)
+
+		close(bs.release)
+		wg.Wait()
+		c.So(checkErr, ShouldBeNil)
+		c.So(checkRes, ShouldNotBeNil)
+		c.So(checkRes.Body, ShouldResemble, []byte("ok"))
+
+		go func() { <-bs.entered }()
+		res, err := idm.Check(ctx, "key")
+		c.So(err, ShouldBeNil)
+		c.So(res, ShouldNotBeNil)
+		c.So(res.Body, ShouldResemble, []byte("ok"))
+	})
+
+	Convey("Idempotency concurrent Sets are not merged", t, func(c C) {
+		ctx := context.Background()
+		ss := &slowSetStore{Store: store.NewRistretto(), entered: make(chan struct{}, 2), release: make(chan struct{})}
+		idm := idempotency.New(idempotency.WithStore(ss))
+
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for n := range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[n] = idm.Set(ctx, "key", &idempotency.Data{Status: http.StatusOK, Body: []byte(strconv.Itoa(n))}, 0)
+			}()
+		}
+		// Both writes must reach the store while the other one is in flight.
+		<-ss.entered
+		<-ss.entered
+		close(ss.release)
+		wg.Wait()
+
+		c.So(errs, ShouldResemble, []error{nil, nil})
+		c.So(ss.calls.Load(), ShouldEqual, 2)
+	})
+
+	Convey("Idempotency parallel Check and Set on many keys", t, func(c C) {
+		ctx := context.Background()
+		idm := idempotency.New(idempotency.WithStore(store.NewRistretto()))
+
+		var (
+			wg     sync.WaitGroup
+			failed atomic.Int32
+		)
+		for i := 0; i < 50; i++ {
+			key := strconv.Itoa(i % 10)
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				if idm.Set(ctx, key, &idempotency.Data{Status: http.StatusOK, Body: []byte(key)}, 0) != nil {
+					failed.Add(1)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				res, err := idm.Check(ctx, key)
+				if err != nil || (res != nil && string(res.Body) != key) {
+					failed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		c.So(failed.Load(), ShouldEqual, 0)
+
+		for i := 0; i < 10; i++ {
+			res, err := idm.Check(ctx, strconv.Itoa(i))
+			c.So(err, ShouldBeNil)
+			c.So(res, ShouldNotBeNil)
+			c.So(string(res.Body), ShouldEqual, strconv.Itoa(i))
+		}
+	})
+}
+
+func TestIdempotencyNamespace(t *testing.T) {
+	Convey("Idempotency namespaces", t, func(c C) {
+		ctx := context.Background()
+		backendStore := store.NewRistretto()
+		idm1 := idempotency.New(idempotency.WithStore(backendStore), idempotency.WithNamespace("svc1"))
+		idm2 := idempotency.New(idempotency.WithStore(backendStore), idempotency.WithNamespace("svc2"))
+
+		err := idm1.Set(ctx, "key", &idempotency.Data{Status: http.StatusOK}, 0)
+		c.So(err, ShouldBeNil)
+
+		res, err := idm2.Check(ctx, "key")
+		c.So(err, ShouldBeNil)
+		c.So(res, ShouldBeNil)
+
+		res, err = idm1.Check(ctx, "key")
+		c.So(err, ShouldBeNil)
+		c.So(res, ShouldNotBeNil)
+
+		v, err := backendStore.Get(ctx, "svc1:key")
+		c.So(err, ShouldBeNil)
+		c.So(v, ShouldNotBeNil)
+	})
+}
+
+func TestIdempotencyCodec(t *testing.T) {
+	Convey("Idempotency codecs", t, func(c C) {
+		data := &idempotency.Data{
+			Status:      http.StatusOK,
+			Body:        []byte{0, 1, 2, 3, 0xff},
+			Header:      map[string]string{"Content-Type": "application/octet-stream"},
+			Headers:     http.Header{"Set-Cookie": {"a=1", "b=2"}},
+			Fingerprint: "fp",
+		}
+		codecs := map[string]idempotency.Codec{
+			"JSON":        idempotency.JSONCodec,
+			"Binary":      idempotency.BinaryCodec,
+			"Gzip/Binary": idempotency.GzipCodec(idempotency.BinaryCodec),
+			"Zstd/JSON":   idempotency.ZstdCodec(idempotency.JSONCodec),
+		}
+		for name, codec := range codecs {
+			raw, err := codec.Encode(data)
+			c.So(err, ShouldBeNil)
+			res := &idempotency.Data{}
+			c.So(codec.Decode(raw, res), ShouldBeNil)
+			c.So(res, ShouldResemble, data)
+
+			idm := idempotency.New(idempotency.WithStore(store.NewRistretto()), idempotency.WithCodec(codec))
+			c.So(idm.Set(context.Background(), name, data, 0), ShouldBeNil)
+			res, err = idm.Check(context.Background(), name)
+			c.So(err, ShouldBeNil)
+			c.So(res, ShouldResemble, data)
+		}
+
+		Convey("New codecs read the records of JSONCodec", func(c C) {
+			raw, err := idempotency.JSONCodec.Encode(data)
+			c.So(err, ShouldBeNil)
+			for _, codec := range codecs {
+				res := &idempotency.Data{}
+				c.So(codec.Decode(raw, res), ShouldBeNil)
+				c.So(res, ShouldResemble, data)
+			}
+		})
+
+		Convey("Corrupted binary data", func(c C) {
+			raw, err := idempotency.BinaryCodec.Encode(data)
+			c.So(err, ShouldBeNil)
+			c.So(idempotency.BinaryCodec.Decode(raw[:len(raw)-2], &idempotency.Data{}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestIdempotencyMaxBodySize(t *testing.T) {
+	Convey("Idempotency max body size", t, func(c C) {
+		ctx := context.Background()
+		data := &idempotency.Data{Status: http.StatusOK, Body: []byte("0123456789")}
+		newIdm := func(policy idempotency.BodyPolicy) *idempotency.Idempotency {
+			return idempotency.New(
+				idempotency.WithStore(store.NewRistretto()),
+				idempotency.WithMaxBodySize(4, policy),
+			)
+		}
+
+		idm := newIdm(idempotency.TruncateBody)
+		c.So(idm.Set(ctx, "k", data, 0), ShouldBeNil)
+		res, err := idm.Check(ctx, "k")
+		c.So(err, ShouldBeNil)
+		c.So(res.Body, ShouldResemble, []byte("0123"))
+		c.So(res.Truncated, ShouldBeTrue)
+		c.So(data.Body, ShouldResemble, []byte("0123456789"))
+
+		idm = newIdm(idempotency.DropBody)
+		c.So(idm.Set(ctx, "k", data, 0), ShouldBeNil)
+		res, err = idm.Check(ctx, "k")
+		c.So(err, ShouldBeNil)
+		c.So(res.Body, ShouldBeEmpty)
+		c.So(res.Truncated, ShouldBeTrue)
+
+		idm = newIdm(idempotency.RejectBody)
+		c.So(idm.Set(ctx, "k", data, 0), ShouldEqual, idempotency.ErrBodyTooLarge)
+		res, err = idm.Check(ctx, "k")
+		c.So(err, ShouldBeNil)
+		c.So(res, ShouldBeNil)
+
+		Convey("Truncated data is not replayed", func(c C) {
+			idm := newIdm(idempotency.TruncateBody)
+			calls := 0
+			fn := func() ([]byte, error) {
+				calls++
+
+				return []byte("0123456789"), nil
+			}
+
+			body, err := idm.Process(ctx, "p", fn)
+			c.So(err, ShouldBeNil)
+			c.So(body, ShouldResemble, []byte("0123456789"))
+
+			body, err = idm.Process(ctx, "p", fn)
+			c.So(err, ShouldEqual, idempotency.ErrTruncated)
+			c.So(body, ShouldBeNil)
+			c.So(calls, ShouldEqual, 1)
+
+			h := idempotency.Middleware(idm)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				_, _ = w.Write([]byte("0123456789"))
+			}))
+			for _, code := range []int{http.StatusOK, http.StatusConflict} {
+				req := httptest.NewRequest(http.MethodPost, "/pay", nil)
+				req.Header.Set(idempotency.HeaderKey, "m")
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+				c.So(rec.Code, ShouldEqual, code)
+			}
+			c.So(calls, ShouldEqual, 2)
+		})
+	})
+}
+
+func TestIdempotencyMiddlewareHeaders(t *testing.T) {
+	Convey("Idempotency middleware keeps repeated headers", t, func(c C) {
+		h := idempotency.Middleware(
+			idempotency.New(
+				idempotency.WithStore(store.NewRistretto()),
+				idempotency.WithCodec(idempotency.BinaryCodec),
+			),
+		)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Set-Cookie", "a=1")
+			w.Header().Add("Set-Cookie", "b=2")
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest(http.MethodPost, "/pay", nil)
+			req.Header.Set(idempotency.HeaderKey, "key")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			c.So(rec.Header().Values("Set-Cookie"), ShouldResemble, []string{"a=1", "b=2"})
+		}
+	})
+}
+
+func TestIdempotencyProcess(t *testing.T) {
+	Convey("Idempotency process", t, func(c C) {
+		ctx := context.Background()
+		backendStore := store.NewRistretto()
+		idm := idempotency.New(idempotency.WithStore(backendStore))
+
+		calls := 0
+		fn := func() ([]byte, error) {
+			calls++
+
+			return []byte("done"), nil
+		}
+
+		out, err := idm.Process(ctx, "msg1", fn)
+		c.So(err, ShouldBeNil)
+		c.So(out, ShouldResemble, []byte("done"))
+		out, err = idm.Process(ctx, "msg1", fn)
+		c.So(err, ShouldBeNil)
+		c.So(out, ShouldResemble, []byte("done"))
+		c.So(calls, ShouldEqual, 1)
+
+		Convey("Failures are not stored", func(c C) {
+			_, err := idm.Process(ctx, "msg2", func() ([]byte, error) {
+				return nil, io.ErrUnexpectedEOF
+			})
+			c.So(err, ShouldEqual, io.ErrUnexpectedEOF)
+			out, err := idm.Process(ctx, "msg2", fn)
+			c.So(err, ShouldBeNil)
+			c.So(out, ShouldResemble, []byte("done"))
+		})
+
+		Convey("Locked keys are reported as in progress", func(c C) {
+			ok, err := backendStore.SetNX(ctx, "msg3:lock", []byte{1}, time.Minute)
+			c.So(err, ShouldBeNil)
+			c.So(ok, ShouldBeTrue)
+			_, err = idm.Process(ctx, "msg3", fn)
+			c.So(err, ShouldEqual, idempotency.ErrInProgress)
+		})
+
+		Convey("Locks taken over by another caller are not released", func(c C) {
+			_, err := idm.Process(ctx, "msg4", func() ([]byte, error) {
+				// The lock expires and another caller takes it while fn is running.
+				c.So(backendStore.Set(ctx, "msg4:lock", []byte("other"), time.Minute), ShouldBeNil)
+
+				return []byte("done"), nil
+			})
+			c.So(err, ShouldBeNil)
+
+			v, err := backendStore.Get(ctx, "msg4:lock")
+			c.So(err, ShouldBeNil)
+			c.So(v, ShouldResemble, []byte("other"))
+		})
+	})
+}
@@ -0,0 +1,157 @@
+package idmgrpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/clubpay/qlubkit-go/idempotency"
+	"github.com/clubpay/qlubkit-go/telemetry/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// MetadataKey is the metadata key which carries the idempotency key.
+const MetadataKey = "idempotency-key"
+
+// UnaryServerInterceptor returns a unary server interceptor which replays the stored
+// response of the calls having the same idempotency key. Calls without MetadataKey,
+// or with request/response which are not proto messages, are passed through.
+// Only successful responses are stored. If the key is reused with a different
+// method or request, it returns codes.InvalidArgument. If the key is being processed by
+// another call, or the stored response has been truncated and cannot be replayed,
+// codes.Aborted is returned.
+func UnaryServerInterceptor(idm *idempotency.Idempotency) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (any, error) {
+		key := keyFromContext(ctx)
+		reqMsg, ok := req.(proto.Message)
+		if key == "" || !ok {
+			return handler(ctx, req)
+		}
+
+		reqBytes, err := proto.MarshalOptions{Deterministic: true}.Marshal(reqMsg)
+		if err != nil {
+			return nil, internalError(ctx, idm, codes.Internal, "idempotency request marshal failed", key, err)
+		}
+		fp, err := idm.Fingerprint("GRPC", info.FullMethod, reqBytes)
+		if err != nil {
+			return nil, internalError(ctx, idm, codes.Internal, "idempotency fingerprint failed", key, err)
+		}
+
+		if res, ok, err := replay(ctx, idm, key, fp); ok {
+			return res, err
+		}
+
+		unlock, err := idm.Lock(ctx, key)
+		switch {
+		case errors.Is(err, idempotency.ErrInProgress):
+			return nil, status.Error(codes.Aborted, err.Error())
+		case err != nil:
+			return nil, internalError(ctx, idm, codes.Unavailable, "idempotency lock failed", key, err)
+		}
+		defer unlock()
+
+		// The key may have been processed by another call before we took the lock.
+		if res, ok, err := replay(ctx, idm, key, fp); ok {
+			return res, err
+		}
+
+		res, err := handler(ctx, req)
+		if err != nil {
+			return res, err
+		}
+		resMsg, ok := res.(proto.Message)
+		if !ok {
+			return res, nil
+		}
+
+		body, err := encodeResponse(resMsg)
+		if err != nil {
+			idm.Logger().ErrorCtx(ctx, "idempotency response encode failed", log.String("key", key), log.Error(err))
+
+			return res, nil
+		}
+
+		// The response is stored even if the client has gone away, otherwise its retry
+		// would run the handler again.
+		setCtx := context.WithoutCancel(ctx)
+		err = idm.Set(setCtx, key, &idempotency.Data{
+			Status:      int(codes.OK),
+			Body:        body,
+			Fingerprint: fp,
+		}, 0)
+		if err != nil {
+			idm.Logger().ErrorCtx(setCtx, "idempotency set failed", log.String("key", key), log.Error(err))
+		}
+
+		return res, nil
+	}
+}
+
+// replay returns the stored response of the key. ok is false if there is no stored
+// response and the call should be handled.
+func replay(ctx context.Context, idm *idempotency.Idempotency, key, fp string) (res any, ok bool, err error) {
+	data, err := idm.CheckRequest(ctx, key, fp)
+	switch {
+	case errors.Is(err, idempotency.ErrFingerprintMismatch):
+		return nil, true, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return nil, true, internalError(ctx, idm, codes.Unavailable, "idempotency check failed", key, err)
+	case data != nil && data.Truncated:
+		return nil, true, status.Error(codes.Aborted, idempotency.ErrTruncated.Error())
+	case data != nil:
+		res, err := decodeResponse(data.Body)
+		if err != nil {
+			return nil, true, internalError(ctx, idm, codes.Internal, "idempotency response decode failed", key, err)
+		}
+
+		return res, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// internalError logs err and returns a status with msg, so the details of the store
+// are not leaked to the client.
+func internalError(ctx context.Context, idm *idempotency.Idempotency, code codes.Code, msg, key string, err error) error {
+	idm.Logger().ErrorCtx(ctx, msg, log.String("key", key), log.Error(err))
+
+	return status.Error(code, msg)
+}
+
+func keyFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	v := md.Get(MetadataKey)
+	if len(v) == 0 {
+		return ""
+	}
+
+	return v[0]
+}
+
+// encodeResponse wraps the response in an Any message, so its type is known on replay.
+func encodeResponse(res proto.Message) ([]byte, error) {
+	a, err := anypb.New(res)
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(a)
+}
+
+func decodeResponse(body []byte) (proto.Message, error) {
+	a := &anypb.Any{}
+	if err := proto.Unmarshal(body, a); err != nil {
+		return nil, err
+	}
+
+	return a.UnmarshalNew()
+}
@@ -0,0 +1,125 @@
+package idmgrpc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/clubpay/qlubkit-go/idempotency"
+	"github.com/clubpay/qlubkit-go/idempotency/idmgrpc"
+	"github.com/clubpay/qlubkit-go/idempotency/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	Convey("Unary server interceptor", t, func(c C) {
+		interceptor := idmgrpc.UnaryServerInterceptor(
+			idempotency.New(idempotency.WithStore(store.NewRistretto())),
+		)
+		info := &grpc.UnaryServerInfo{FullMethod: "/payment.Service/Pay"}
+		calls := 0
+		handler := func(ctx context.Context, req any) (any, error) {
+			calls++
+
+			return wrapperspb.String("paid " + req.(*wrapperspb.StringValue).GetValue()), nil
+		}
+		ctx := metadata.NewIncomingContext(
+			context.Background(),
+			metadata.Pairs(idmgrpc.MetadataKey, "key1"),
+		)
+
+		res, err := interceptor(ctx, wrapperspb.String("10"), info, handler)
+		c.So(err, ShouldBeNil)
+		c.So(res.(*wrapperspb.StringValue).GetValue(), ShouldEqual, "paid 10")
+
+		res, err = interceptor(ctx, wrapperspb.String("10"), info, handler)
+		c.So(err, ShouldBeNil)
+		c.So(proto.Equal(res.(proto.Message), wrapperspb.String("paid 10")), ShouldBeTrue)
+		c.So(calls, ShouldEqual, 1)
+
+		_, err = interceptor(ctx, wrapperspb.String("20"), info, handler)
+		c.So(status.Code(err), ShouldEqual, codes.InvalidArgument)
+		c.So(calls, ShouldEqual, 1)
+
+		_, err = interceptor(context.Background(), wrapperspb.String("20"), info, handler)
+		c.So(err, ShouldBeNil)
+		c.So(calls, ShouldEqual, 2)
+
+		Convey("Truncated responses are not replayed", func(c C) {
+			interceptor := idmgrpc.UnaryServerInterceptor(
+				idempotency.New(
+					idempotency.WithStore(store.NewRistretto()),
+					idempotency.WithMaxBodySize(4, idempotency.TruncateBody),
+				),
+			)
+
+			_, err := interceptor(ctx, wrapperspb.String("10"), info, handler)
+			c.So(err, ShouldBeNil)
+			_, err = interceptor(ctx, wrapperspb.String("10"), info, handler)
+			c.So(status.Code(err), ShouldEqual, codes.Aborted)
+			c.So(calls, ShouldEqual, 3)
+		})
+
+		Convey("Concurrent duplicates are aborted", func(c C) {
+			interceptor := idmgrpc.UnaryServerInterceptor(
+				idempotency.New(idempotency.WithStore(store.NewRistretto())),
+			)
+			entered := make(chan struct{})
+			release := make(chan struct{})
+			slow := func(ctx context.Context, req any) (any, error) {
+				close(entered)
+				<-release
+
+				return handler(ctx, req)
+			}
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := interceptor(ctx, wrapperspb.String("10"), info, slow)
+				done <- err
+			}()
+			<-entered
+
+			_, err := interceptor(ctx, wrapperspb.String("10"), info, handler)
+			c.So(status.Code(err), ShouldEqual, codes.Aborted)
+			c.So(status.Convert(err).Message(), ShouldEqual, idempotency.ErrInProgress.Error())
+
+			close(release)
+			c.So(<-done, ShouldBeNil)
+			res, err := interceptor(ctx, wrapperspb.String("10"), info, handler)
+			c.So(err, ShouldBeNil)
+			c.So(proto.Equal(res.(proto.Message), wrapperspb.String("paid 10")), ShouldBeTrue)
+			c.So(calls, ShouldEqual, 3)
+		})
+
+		Convey("Store errors are not exposed", func(c C) {
+			interceptor := idmgrpc.UnaryServerInterceptor(
+				idempotency.New(
+					idempotency.WithStore(failingStore{Store: store.NewRistretto(), err: errors.New("redis: secret-host:6379 refused")}),
+				),
+			)
+
+			_, err := interceptor(ctx, wrapperspb.String("10"), info, handler)
+			c.So(status.Code(err), ShouldEqual, codes.Unavailable)
+			c.So(err.Error(), ShouldNotContainSubstring, "secret-host")
+			c.So(calls, ShouldEqual, 2)
+		})
+	})
+}
+
+// failingStore fails all the calls with err.
+type failingStore struct {
+	store.Store
+	err error
+}
+
+func (s failingStore) Get(context.Context, string) ([]byte, error) {
+	return nil, s.err
+}
@@ -0,0 +1,48 @@
+package idmkafka
+
+import (
+	"context"
+	"errors"
+
+	"github.com/clubpay/qlubkit-go/idempotency"
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrNoKey is returned by Process if KeyFunc returns an empty key.
+var ErrNoKey = errors.New("message has no idempotency key")
+
+// KeyFunc extracts the idempotency key of a message.
+type KeyFunc func(msg kafka.Message) string
+
+// ByMessageKey uses the message key as the idempotency key.
+func ByMessageKey() KeyFunc {
+	return func(msg kafka.Message) string {
+		return string(msg.Key)
+	}
+}
+
+// ByHeader uses the value of the given header as the idempotency key.
+func ByHeader(name string) KeyFunc {
+	return func(msg kafka.Message) string {
+		for _, h := range msg.Headers {
+			if h.Key == name {
+				return string(h.Value)
+			}
+		}
+
+		return ""
+	}
+}
+
+// Process runs fn only once per idempotency key of msg, see idempotency.Process.
+func Process(
+	ctx context.Context, idm *idempotency.Idempotency, msg kafka.Message, keyFn KeyFunc,
+	fn func() ([]byte, error),
+) ([]byte, error) {
+	key := keyFn(msg)
+	if key == "" {
+		return nil, ErrNoKey
+	}
+
+	return idm.Process(ctx, key, fn)
+}
@@ -0,0 +1,66 @@
+package idmkafka_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/clubpay/qlubkit-go/idempotency"
+	"github.com/clubpay/qlubkit-go/idempotency/idmkafka"
+	"github.com/clubpay/qlubkit-go/idempotency/store"
+	"github.com/segmentio/kafka-go"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProcess(t *testing.T) {
+	Convey("Process kafka messages", t, func(c C) {
+		ctx := context.Background()
+		idm := idempotency.New(idempotency.WithStore(store.NewRistretto()))
+		calls := 0
+		fn := func() ([]byte, error) {
+			calls++
+
+			return []byte("done"), nil
+		}
+
+		Convey("ByMessageKey skips duplicate messages", func(c C) {
+			msg := kafka.Message{Key: []byte("order-1"), Value: []byte("v1")}
+			for range 2 {
+				out, err := idmkafka.Process(ctx, idm, msg, idmkafka.ByMessageKey(), fn)
+				c.So(err, ShouldBeNil)
+				c.So(out, ShouldResemble, []byte("done"))
+			}
+			c.So(calls, ShouldEqual, 1)
+
+			_, err := idmkafka.Process(ctx, idm, kafka.Message{Key: []byte("order-2")}, idmkafka.ByMessageKey(), fn)
+			c.So(err, ShouldBeNil)
+			c.So(calls, ShouldEqual, 2)
+		})
+
+		Convey("ByHeader skips duplicate messages", func(c C) {
+			keyFn := idmkafka.ByHeader("event-id")
+			msg := func(offset int64) kafka.Message {
+				return kafka.Message{
+					Offset:  offset,
+					Key:     []byte("order-1"),
+					Headers: []kafka.Header{{Key: "trace", Value: []byte("x")}, {Key: "event-id", Value: []byte("e1")}},
+				}
+			}
+			for offset := range int64(2) {
+				_, err := idmkafka.Process(ctx, idm, msg(offset), keyFn, fn)
+				c.So(err, ShouldBeNil)
+			}
+			c.So(calls, ShouldEqual, 1)
+		})
+
+		Convey("Messages without a key are rejected", func(c C) {
+			_, err := idmkafka.Process(ctx, idm, kafka.Message{Value: []byte("v1")}, idmkafka.ByMessageKey(), fn)
+			c.So(err, ShouldEqual, idmkafka.ErrNoKey)
+
+			msg := kafka.Message{Key: []byte("order-1"), Headers: []kafka.Header{{Key: "trace", Value: []byte("x")}}}
+			_, err = idmkafka.Process(ctx, idm, msg, idmkafka.ByHeader("event-id"), fn)
+			c.So(err, ShouldEqual, idmkafka.ErrNoKey)
+			c.So(calls, ShouldEqual, 0)
+		})
+	})
+}
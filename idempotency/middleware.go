@@ -0,0 +1,131 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/clubpay/qlubkit-go/telemetry/log"
+)
+
+// HeaderKey is the request header which carries the idempotency key.
+const HeaderKey = "Idempotency-Key"
+
+// Middleware returns a net/http middleware which replays the stored response of the
+// requests having the same idempotency key. Requests without the HeaderKey are passed
+// through. If the key is reused with a different request, it responds with 422. Request
+// bodies larger than the size given by WithMaxRequestSize are rejected with 413. If the
+// stored response has been truncated, it cannot be replayed and it responds with 409.
+func Middleware(idm *Idempotency) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(HeaderKey)
+			if key == "" {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, idm.maxReqSize))
+			if err != nil {
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				} else {
+					http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				}
+
+				return
+			}
+			_ = r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			fp, err := idm.Fingerprint(r.Method, r.URL.Path, body)
+			if err != nil {
+				internalError(w, r, idm, "idempotency fingerprint failed", key, err)
+
+				return
+			}
+
+			data, err := idm.CheckRequest(r.Context(), key, fp)
+			switch {
+			case errors.Is(err, ErrFingerprintMismatch):
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+
+				return
+			case err != nil:
+				internalError(w, r, idm, "idempotency check failed", key, err)
+
+				return
+			case data != nil && data.Truncated:
+				http.Error(w, ErrTruncated.Error(), http.StatusConflict)
+
+				return
+			case data != nil:
+				writeData(w, data)
+
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			// Server errors are not stored, so the client can retry them.
+			if rec.status >= http.StatusInternalServerError {
+				return
+			}
+
+			// The response is stored even if the client has gone away, otherwise its retry
+			// would run the handler again.
+			ctx := context.WithoutCancel(r.Context())
+			err = idm.Set(ctx, key, &Data{
+				Status:      rec.status,
+				Body:        rec.body.Bytes(),
+				Headers:     w.Header().Clone(),
+				Fingerprint: fp,
+			}, 0)
+			if err != nil {
+				idm.logger.ErrorCtx(ctx, "idempotency set failed", log.String("key", key), log.Error(err))
+			}
+		})
+	}
+}
+
+// internalError logs err and responds with a generic message, so the details of the
+// store are not leaked to the client.
+func internalError(w http.ResponseWriter, r *http.Request, idm *Idempotency, msg, key string, err error) {
+	idm.logger.ErrorCtx(r.Context(), msg, log.String("key", key), log.Error(err))
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+func writeData(w http.ResponseWriter, data *Data) {
+	for k, vv := range data.HTTPHeader() {
+		w.Header()[k] = vv
+	}
+	w.WriteHeader(data.Status)
+	_, _ = w.Write(data.Body)
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+
+	return r.ResponseWriter.Write(b)
+}
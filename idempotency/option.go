@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/clubpay/qlubkit-go/idempotency/store"
+	"github.com/clubpay/qlubkit-go/telemetry/log"
 )
 
 func WithTTL(ttl time.Duration) func(*Idempotency) {
@@ -17,3 +18,55 @@ func WithStore(store store.Store) func(*Idempotency) {
 		i.store = store
 	}
 }
+
+func WithFingerprint(fn FingerprintFunc) func(*Idempotency) {
+	return func(i *Idempotency) {
+		i.fingerprint = fn
+	}
+}
+
+// WithNamespace prefixes all the keys with "namespace:", hence multiple services can
+// share the same store.
+func WithNamespace(namespace string) func(*Idempotency) {
+	return func(i *Idempotency) {
+		i.namespace = namespace
+	}
+}
+
+// WithCodec sets the codec used to store the data, default is JSONCodec.
+func WithCodec(codec Codec) func(*Idempotency) {
+	return func(i *Idempotency) {
+		i.codec = codec
+	}
+}
+
+// WithMaxBodySize limits the size of the stored bodies, policy decides what happens
+// to the larger bodies.
+func WithMaxBodySize(size int, policy BodyPolicy) func(*Idempotency) {
+	return func(i *Idempotency) {
+		i.maxBodySize = size
+		i.bodyPolicy = policy
+	}
+}
+
+// WithLockTTL sets how long Process keeps a key locked while it is being processed.
+func WithLockTTL(ttl time.Duration) func(*Idempotency) {
+	return func(i *Idempotency) {
+		i.lockTTL = ttl
+	}
+}
+
+// WithMaxRequestSize limits the size of the request bodies read by Middleware, larger
+// requests are rejected with 413. Default is 1MB.
+func WithMaxRequestSize(size int64) func(*Idempotency) {
+	return func(i *Idempotency) {
+		i.maxReqSize = size
+	}
+}
+
+// WithLogger sets the logger which reports the store errors, default is log.DefaultLogger.
+func WithLogger(l *log.Logger) func(*Idempotency) {
+	return func(i *Idempotency) {
+		i.logger = l
+	}
+}
@@ -0,0 +1,5 @@
+package store
+
+func (s *SQLStore) Rebind(q string) string {
+	return s.rebind(q)
+}
@@ -1,9 +1,151 @@
 package store
 
-import "time"
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+)
 
+// Store is the backend which keeps the idempotency records. Get must return a nil
+// value and nil error if the key does not exist. A zero ttl means the key never expires.
 type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// SetNX sets the value only if the key does not exist, and reports whether it was set.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	Delete(ctx context.Context, key string) error
+	// Touch updates the ttl of an existing key.
+	Touch(ctx context.Context, key string, ttl time.Duration) error
+}
+
+// CompareAndDeleter is implemented by the stores which can delete a key only if it
+// holds the given value, so a caller does not delete a key which has been taken over
+// by another caller, e.g. an expired lock.
+type CompareAndDeleter interface {
+	// CompareAndDelete deletes the key if its value equals value, and reports whether
+	// it was deleted.
+	CompareAndDelete(ctx context.Context, key string, value []byte) (bool, error)
+}
+
+// CompareAndDelete deletes the key of s if its value equals value. If s does not
+// implement CompareAndDeleter, the value is compared before the delete, which is not
+// atomic.
+func CompareAndDelete(ctx context.Context, s Store, key string, value []byte) (bool, error) {
+	if cd, ok := s.(CompareAndDeleter); ok {
+		return cd.CompareAndDelete(ctx, key, value)
+	}
+
+	v, err := s.Get(ctx, key)
+	if err != nil || !bytes.Equal(v, value) {
+		return false, err
+	}
+
+	return true, s.Delete(ctx, key)
+}
+
+// LegacyStore is the previous version of the Store interface.
+//
+// Deprecated: implement Store instead and use FromLegacy until then.
+type LegacyStore interface {
 	SetTTL(duration time.Duration)
 	GetValue(key string) ([]byte, error)
 	SetValue(key string, value []byte) error
 }
+
+// FromLegacy adapts a LegacyStore to the Store interface. Since LegacyStore has no
+// atomic operations, SetNX and Touch are only atomic among the adapters of the same
+// LegacyStore, and Delete stores an empty value which Get reports as a missing key.
+// The ttl is set by SetTTL right before each write, hence s must not be written
+// directly while it is adapted.
+func FromLegacy(s LegacyStore) Store {
+	mtx, _ := legacyLocks.LoadOrStore(s, &sync.Mutex{})
+
+	return &legacyStore{mtx: mtx.(*sync.Mutex), s: s}
+}
+
+// legacyLocks keeps a lock per LegacyStore, so SetTTL and SetValue of the adapters
+// sharing a LegacyStore do not interleave.
+var legacyLocks sync.Map
+
+type legacyStore struct {
+	mtx *sync.Mutex
+	s   LegacyStore
+}
+
+var (
+	_ Store             = (*legacyStore)(nil)
+	_ CompareAndDeleter = (*legacyStore)(nil)
+)
+
+func (l *legacyStore) Get(_ context.Context, key string) ([]byte, error) {
+	v, err := l.s.GetValue(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(v) == 0 {
+		return nil, nil
+	}
+
+	return v, nil
+}
+
+func (l *legacyStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	return l.set(key, value, ttl)
+}
+
+func (l *legacyStore) SetNX(_ context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	v, err := l.s.GetValue(key)
+	if err != nil {
+		return false, err
+	}
+	if len(v) > 0 {
+		return false, nil
+	}
+
+	return true, l.set(key, value, ttl)
+}
+
+func (l *legacyStore) Delete(_ context.Context, key string) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	return l.set(key, nil, time.Second)
+}
+
+func (l *legacyStore) CompareAndDelete(_ context.Context, key string, value []byte) (bool, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	v, err := l.s.GetValue(key)
+	if err != nil || len(v) == 0 || !bytes.Equal(v, value) {
+		return false, err
+	}
+
+	return true, l.set(key, nil, time.Second)
+}
+
+func (l *legacyStore) Touch(_ context.Context, key string, ttl time.Duration) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	v, err := l.s.GetValue(key)
+	if err != nil || len(v) == 0 {
+		return err
+	}
+
+	return l.set(key, v, ttl)
+}
+
+// set writes the value with the ttl. The caller must hold the lock.
+func (l *legacyStore) set(key string, value []byte, ttl time.Duration) error {
+	l.s.SetTTL(ttl)
+
+	return l.s.SetValue(key, value)
+}
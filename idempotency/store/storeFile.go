@@ -0,0 +1,196 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileStore keeps each record in a separate file inside a directory. It is meant for
+// single-node tools; the directory must not be shared between processes.
+type FileStore struct {
+	mtx sync.Mutex
+	dir string
+}
+
+var _ Store = (*FileStore)(nil)
+
+// NewFileStore creates a FileStore in dir and creates dir if it does not exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &FileStore{
+		dir: dir,
+	}, nil
+}
+
+func (s *FileStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	v, _, err := s.read(key)
+
+	return v, err
+}
+
+func (s *FileStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.write(key, value, expiresAt(time.Now(), ttl))
+}
+
+func (s *FileStore) SetNX(_ context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	_, found, err := s.read(key)
+	if err != nil || found {
+		return false, err
+	}
+
+	return true, s.write(key, value, expiresAt(time.Now(), ttl))
+}
+
+func (s *FileStore) Delete(_ context.Context, key string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.remove(key)
+}
+
+func (s *FileStore) CompareAndDelete(_ context.Context, key string, value []byte) (bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	v, found, err := s.read(key)
+	if err != nil || !found || !bytes.Equal(v, value) {
+		return false, err
+	}
+
+	return true, s.remove(key)
+}
+
+func (s *FileStore) Touch(_ context.Context, key string, ttl time.Duration) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	v, found, err := s.read(key)
+	if err != nil || !found {
+		return err
+	}
+
+	return s.write(key, v, expiresAt(time.Now(), ttl))
+}
+
+// Sweep removes the expired records and returns the number of removed records.
+func (s *FileStore) Sweep(_ context.Context) (int64, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	now := time.Now()
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != "" {
+			continue
+		}
+		p := filepath.Join(s.dir, e.Name())
+		exp, err := readExpiry(p)
+		if err != nil || !expired(exp, now) {
+			continue
+		}
+		if os.Remove(p) == nil {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (s *FileStore) remove(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *FileStore) path(key string) string {
+	h := sha256.Sum256([]byte(key))
+
+	return filepath.Join(s.dir, hex.EncodeToString(h[:]))
+}
+
+func (s *FileStore) read(key string) ([]byte, bool, error) {
+	b, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(b) < 8 {
+		return nil, false, errors.New("corrupted record")
+	}
+	if expired(int64(binary.BigEndian.Uint64(b[:8])), time.Now()) {
+		_ = os.Remove(s.path(key))
+
+		return nil, false, nil
+	}
+
+	return b[8:], true, nil
+}
+
+// write stores the record in a temporary file and renames it, so readers never see
+// a partially written record.
+func (s *FileStore) write(key string, value []byte, expiresAt int64) error {
+	f, err := os.CreateTemp(s.dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	var hdr [8]byte
+	binary.BigEndian.PutUint64(hdr[:], uint64(expiresAt))
+	if _, err = f.Write(append(hdr[:], value...)); err != nil {
+		_ = f.Close()
+
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), s.path(key))
+}
+
+func readExpiry(p string) (int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var hdr [8]byte
+	if _, err = f.Read(hdr[:]); err != nil {
+		return 0, err
+	}
+
+	return int64(binary.BigEndian.Uint64(hdr[:])), nil
+}
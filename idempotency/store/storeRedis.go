@@ -2,35 +2,64 @@ package store
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 type storeRedis struct {
-	redisClient *redis.Client
-	ctx         context.Context
-	ttl         time.Duration
+	redisClient redis.UniversalClient
 }
 
-var _ Store = (*storeRedis)(nil)
+var (
+	_ Store             = (*storeRedis)(nil)
+	_ CompareAndDeleter = (*storeRedis)(nil)
+)
+
+var compareAndDelete = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
 
-func NewRedisStore(redisClient *redis.Client, ctx context.Context) Store {
+// NewRedisStore creates a store on top of a single node, cluster or sentinel client.
+func NewRedisStore(redisClient redis.UniversalClient) Store {
 	sr := storeRedis{
 		redisClient: redisClient,
-		ctx:         ctx,
 	}
 	return &sr
 }
 
-func (s *storeRedis) SetTTL(duration time.Duration) {
-	s.ttl = duration
+func (s *storeRedis) Get(ctx context.Context, key string) ([]byte, error) {
+	v, err := s.redisClient.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return v, err
+}
+
+func (s *storeRedis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.redisClient.Set(ctx, key, value, ttl).Err()
 }
 
-func (s *storeRedis) GetValue(key string) ([]byte, error) {
-	return s.redisClient.Get(context.TODO(), key).Bytes()
+func (s *storeRedis) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return s.redisClient.SetNX(ctx, key, value, ttl).Result()
 }
 
-func (s *storeRedis) SetValue(key string, value []byte) error {
-	return s.redisClient.Set(context.TODO(), key, value, s.ttl).Err()
+func (s *storeRedis) Delete(ctx context.Context, key string) error {
+	return s.redisClient.Del(ctx, key).Err()
+}
+
+func (s *storeRedis) CompareAndDelete(ctx context.Context, key string, value []byte) (bool, error) {
+	n, err := compareAndDelete.Run(ctx, s.redisClient, []string{key}, value).Int()
+	return n == 1, err
+}
+
+func (s *storeRedis) Touch(ctx context.Context, key string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return s.redisClient.Persist(ctx, key).Err()
+	}
+	return s.redisClient.Expire(ctx, key, ttl).Err()
 }
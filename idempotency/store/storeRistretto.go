@@ -1,6 +1,8 @@
 package store
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"sync"
 	"time"
@@ -11,11 +13,15 @@ import (
 var lock = &sync.Mutex{}
 
 type storeRistretto struct {
+	// mtx makes the read-modify-write operations (SetNX, Touch) atomic.
+	mtx sync.Mutex
 	c   *ristretto.Cache[string, []byte]
-	ttl time.Duration
 }
 
-var _ Store = (*storeRistretto)(nil)
+var (
+	_ Store             = (*storeRistretto)(nil)
+	_ CompareAndDeleter = (*storeRistretto)(nil)
+)
 
 func NewRistretto() Store {
 	lock.Lock()
@@ -34,11 +40,7 @@ func NewRistretto() Store {
 	}
 }
 
-func (s *storeRistretto) SetTTL(duration time.Duration) {
-	s.ttl = duration
-}
-
-func (s *storeRistretto) GetValue(key string) ([]byte, error) {
+func (s *storeRistretto) Get(_ context.Context, key string) ([]byte, error) {
 	oldData, found := s.c.Get(key)
 	if !found {
 		return nil, nil
@@ -46,8 +48,58 @@ func (s *storeRistretto) GetValue(key string) ([]byte, error) {
 	return oldData, nil
 }
 
-func (s *storeRistretto) SetValue(key string, value []byte) error {
-	res := s.c.SetWithTTL(key, value, 1, s.ttl)
+func (s *storeRistretto) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.set(key, value, ttl)
+}
+
+func (s *storeRistretto) SetNX(_ context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if _, found := s.c.Get(key); found {
+		return false, nil
+	}
+	return true, s.set(key, value, ttl)
+}
+
+func (s *storeRistretto) Delete(_ context.Context, key string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.c.Del(key)
+	s.c.Wait()
+	return nil
+}
+
+func (s *storeRistretto) CompareAndDelete(_ context.Context, key string, value []byte) (bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	v, found := s.c.Get(key)
+	if !found || !bytes.Equal(v, value) {
+		return false, nil
+	}
+	s.c.Del(key)
+	s.c.Wait()
+	return true, nil
+}
+
+func (s *storeRistretto) Touch(_ context.Context, key string, ttl time.Duration) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	v, found := s.c.Get(key)
+	if !found {
+		return nil
+	}
+	return s.set(key, v, ttl)
+}
+
+func (s *storeRistretto) set(key string, value []byte, ttl time.Duration) error {
+	res := s.c.SetWithTTL(key, value, 1, ttl)
 	s.c.Wait()
 	if !res {
 		return errors.New("value cannot be set")
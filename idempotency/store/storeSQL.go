@@ -0,0 +1,259 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Dialect selects the SQL flavour used by SQLStore.
+type Dialect int
+
+const (
+	DialectPostgres Dialect = iota
+	DialectMySQL
+	DialectSQLite
+)
+
+const defaultSQLTable = "idempotency_keys"
+
+// SQLStore keeps the records in a database/sql table. Expired rows are ignored on
+// read and removed by Sweep or the sweeper started by StartSweeper.
+type SQLStore struct {
+	db      *sql.DB
+	dialect Dialect
+	table   string
+}
+
+var (
+	_ Store             = (*SQLStore)(nil)
+	_ CompareAndDeleter = (*SQLStore)(nil)
+)
+
+// NewSQLStore creates a store on top of db. If table is empty "idempotency_keys" is used.
+// Call CreateTable once to create the table if it does not exist.
+func NewSQLStore(db *sql.DB, dialect Dialect, table string) *SQLStore {
+	if table == "" {
+		table = defaultSQLTable
+	}
+
+	return &SQLStore{
+		db:      db,
+		dialect: dialect,
+		table:   table,
+	}
+}
+
+// CreateTable creates the table and its expiry index if they do not exist.
+func (s *SQLStore) CreateTable(ctx context.Context) error {
+	var stmts []string
+	switch s.dialect {
+	case DialectMySQL:
+		stmts = []string{
+			fmt.Sprintf(
+				"CREATE TABLE IF NOT EXISTS %s (k VARCHAR(255) NOT NULL PRIMARY KEY, v LONGBLOB, "+
+					"expires_at BIGINT NOT NULL DEFAULT 0, INDEX %s_expires_at_idx (expires_at))",
+				s.table, s.table,
+			),
+		}
+	default:
+		blob := "BLOB"
+		if s.dialect == DialectPostgres {
+			blob = "BYTEA"
+		}
+		stmts = []string{
+			fmt.Sprintf(
+				"CREATE TABLE IF NOT EXISTS %s (k VARCHAR(255) NOT NULL PRIMARY KEY, v %s, "+
+					"expires_at BIGINT NOT NULL DEFAULT 0)",
+				s.table, blob,
+			),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_expires_at_idx ON %s (expires_at)", s.table, s.table),
+		}
+	}
+
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, key string) ([]byte, error) {
+	var (
+		v         []byte
+		expiresAt int64
+	)
+	err := s.db.QueryRowContext(
+		ctx,
+		s.rebind("SELECT v, expires_at FROM %s WHERE k = ?"),
+		key,
+	).Scan(&v, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expired(expiresAt, time.Now()) {
+		return nil, nil
+	}
+
+	return v, nil
+}
+
+func (s *SQLStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	var q string
+	switch s.dialect {
+	case DialectMySQL:
+		q = "INSERT INTO %s (k, v, expires_at) VALUES (?, ?, ?) " +
+			"ON DUPLICATE KEY UPDATE v = VALUES(v), expires_at = VALUES(expires_at)"
+	default:
+		q = "INSERT INTO %s (k, v, expires_at) VALUES (?, ?, ?) " +
+			"ON CONFLICT (k) DO UPDATE SET v = excluded.v, expires_at = excluded.expires_at"
+	}
+	_, err := s.db.ExecContext(ctx, s.rebind(q), key, value, expiresAt(time.Now(), ttl))
+
+	return err
+}
+
+func (s *SQLStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	var q string
+	switch s.dialect {
+	case DialectMySQL:
+		q = "INSERT IGNORE INTO %s (k, v, expires_at) VALUES (?, ?, ?)"
+	case DialectSQLite:
+		q = "INSERT OR IGNORE INTO %s (k, v, expires_at) VALUES (?, ?, ?)"
+	default:
+		q = "INSERT INTO %s (k, v, expires_at) VALUES (?, ?, ?) ON CONFLICT (k) DO NOTHING"
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now()
+	// An expired row must not block the insert.
+	_, err = tx.ExecContext(
+		ctx,
+		s.rebind("DELETE FROM %s WHERE k = ? AND expires_at <> 0 AND expires_at <= ?"),
+		key, now.UnixMilli(),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := tx.ExecContext(ctx, s.rebind(q), key, value, expiresAt(now, ttl))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, tx.Commit()
+}
+
+func (s *SQLStore) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind("DELETE FROM %s WHERE k = ?"), key)
+
+	return err
+}
+
+func (s *SQLStore) CompareAndDelete(ctx context.Context, key string, value []byte) (bool, error) {
+	res, err := s.db.ExecContext(
+		ctx,
+		s.rebind("DELETE FROM %s WHERE k = ? AND v = ? AND (expires_at = 0 OR expires_at > ?)"),
+		key, value, time.Now().UnixMilli(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+
+	return n == 1, err
+}
+
+func (s *SQLStore) Touch(ctx context.Context, key string, ttl time.Duration) error {
+	now := time.Now()
+	_, err := s.db.ExecContext(
+		ctx,
+		s.rebind("UPDATE %s SET expires_at = ? WHERE k = ? AND (expires_at = 0 OR expires_at > ?)"),
+		expiresAt(now, ttl), key, now.UnixMilli(),
+	)
+
+	return err
+}
+
+// Sweep removes the expired rows and returns the number of removed rows.
+func (s *SQLStore) Sweep(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(
+		ctx,
+		s.rebind("DELETE FROM %s WHERE expires_at <> 0 AND expires_at <= ?"),
+		time.Now().UnixMilli(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// StartSweeper runs Sweep every interval in the background until ctx is done.
+func (s *SQLStore) StartSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				_, _ = s.Sweep(ctx)
+			}
+		}
+	}()
+}
+
+// rebind formats the table name into q and converts the '?' placeholders to the
+// dialect's placeholders.
+func (s *SQLStore) rebind(q string) string {
+	q = fmt.Sprintf(q, s.table)
+	if s.dialect != DialectPostgres {
+		return q
+	}
+
+	out := make([]byte, 0, len(q)+8)
+	n := 0
+	for i := 0; i < len(q); i++ {
+		if q[i] != '?' {
+			out = append(out, q[i])
+
+			continue
+		}
+		n++
+		out = append(out, fmt.Sprintf("$%d", n)...)
+	}
+
+	return string(out)
+}
+
+// expiresAt returns the expiry time in unix milliseconds, zero means no expiry.
+func expiresAt(now time.Time, ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return now.Add(ttl).UnixMilli()
+}
+
+func expired(expiresAt int64, now time.Time) bool {
+	return expiresAt != 0 && expiresAt <= now.UnixMilli()
+}
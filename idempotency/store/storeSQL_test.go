@@ -0,0 +1,132 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/clubpay/qlubkit-go/idempotency/store"
+	_ "github.com/mattn/go-sqlite3"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newSQLiteStore(t *testing.T) *store.SQLStore {
+	dsn := fmt.Sprintf(
+		"file:%s?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate",
+		filepath.Join(t.TempDir(), "idempotency.db"),
+	)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	s := store.NewSQLStore(db, store.DialectSQLite, "")
+	if err = s.CreateTable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestSQLStore(t *testing.T) {
+	Convey("SQL store", t, func(c C) {
+		ctx := context.Background()
+		s := newSQLiteStore(t)
+
+		Convey("SQLite", func(c C) {
+			testStore(c, s, time.Sleep)
+			c.So(s.CreateTable(ctx), ShouldBeNil)
+		})
+
+		Convey("Concurrent SetNX has a single winner", func(c C) {
+			var (
+				wg   sync.WaitGroup
+				won  atomic.Int32
+				errs atomic.Int32
+			)
+			for i := range 20 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ok, err := s.SetNX(ctx, "k1", []byte(fmt.Sprint(i)), time.Minute)
+					if err != nil {
+						errs.Add(1)
+					}
+					if ok {
+						won.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			c.So(errs.Load(), ShouldEqual, 0)
+			c.So(won.Load(), ShouldEqual, 1)
+		})
+
+		Convey("Expired rows are ignored", func(c C) {
+			c.So(s.Set(ctx, "k1", []byte("v1"), 20*time.Millisecond), ShouldBeNil)
+			ok, err := s.SetNX(ctx, "k1", []byte("v2"), time.Minute)
+			c.So(err, ShouldBeNil)
+			c.So(ok, ShouldBeFalse)
+
+			time.Sleep(30 * time.Millisecond)
+			v, err := s.Get(ctx, "k1")
+			c.So(err, ShouldBeNil)
+			c.So(v, ShouldBeNil)
+
+			c.So(s.Touch(ctx, "k1", time.Hour), ShouldBeNil)
+			v, err = s.Get(ctx, "k1")
+			c.So(err, ShouldBeNil)
+			c.So(v, ShouldBeNil)
+
+			ok, err = s.SetNX(ctx, "k1", []byte("v2"), time.Minute)
+			c.So(err, ShouldBeNil)
+			c.So(ok, ShouldBeTrue)
+			v, err = s.Get(ctx, "k1")
+			c.So(err, ShouldBeNil)
+			c.So(v, ShouldResemble, []byte("v2"))
+		})
+
+		Convey("Sweep removes the expired rows", func(c C) {
+			c.So(s.Set(ctx, "k1", []byte("v1"), 20*time.Millisecond), ShouldBeNil)
+			c.So(s.Set(ctx, "k2", []byte("v2"), 20*time.Millisecond), ShouldBeNil)
+			c.So(s.Set(ctx, "k3", []byte("v3"), time.Hour), ShouldBeNil)
+			c.So(s.Set(ctx, "k4", []byte("v4"), 0), ShouldBeNil)
+
+			n, err := s.Sweep(ctx)
+			c.So(err, ShouldBeNil)
+			c.So(n, ShouldEqual, 0)
+
+			time.Sleep(30 * time.Millisecond)
+			n, err = s.Sweep(ctx)
+			c.So(err, ShouldBeNil)
+			c.So(n, ShouldEqual, 2)
+
+			for _, k := range []string{"k3", "k4"} {
+				v, err := s.Get(ctx, k)
+				c.So(err, ShouldBeNil)
+				c.So(v, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestSQLStoreRebind(t *testing.T) {
+	Convey("SQL store placeholders", t, func(c C) {
+		q := "UPDATE %s SET expires_at = ? WHERE k = ? AND expires_at > ?"
+
+		s := store.NewSQLStore(nil, store.DialectPostgres, "")
+		c.So(s.Rebind(q), ShouldEqual, "UPDATE idempotency_keys SET expires_at = $1 WHERE k = $2 AND expires_at > $3")
+
+		for _, d := range []store.Dialect{store.DialectMySQL, store.DialectSQLite} {
+			s = store.NewSQLStore(nil, d, "idm")
+			c.So(s.Rebind(q), ShouldEqual, "UPDATE idm SET expires_at = ? WHERE k = ? AND expires_at > ?")
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// storeTwoTier reads through a local store (e.g. Ristretto) to a remote store (e.g.
+// Redis). The remote store is the source of truth, the local store only keeps the
+// records for at most localTTL to save round-trips.
+//
+// The local store of a replica is not invalidated by the writes of the other
+// replicas, hence Get may return a value which has been overwritten or deleted by
+// another replica for up to localTTL. SetNX, which decides the ownership of a key,
+// always goes to the remote store and its values are not cached locally.
+type storeTwoTier struct {
+	local    Store
+	remote   Store
+	localTTL time.Duration
+}
+
+var (
+	_ Store             = (*storeTwoTier)(nil)
+	_ CompareAndDeleter = (*storeTwoTier)(nil)
+)
+
+// NewTwoTierStore creates a store which caches the records of remote in local for at
+// most localTTL, which bounds how long a replica may read a stale record. Use it for
+// records which are written once, e.g. the stored responses. Errors of the local
+// store are ignored on writes.
+func NewTwoTierStore(local, remote Store, localTTL time.Duration) Store {
+	return &storeTwoTier{
+		local:    local,
+		remote:   remote,
+		localTTL: localTTL,
+	}
+}
+
+func (s *storeTwoTier) Get(ctx context.Context, key string) ([]byte, error) {
+	v, err := s.local.Get(ctx, key)
+	if err == nil && v != nil {
+		return v, nil
+	}
+
+	v, err = s.remote.Get(ctx, key)
+	if err != nil || v == nil {
+		return v, err
+	}
+	_ = s.local.Set(ctx, key, v, s.ttl(0))
+
+	return v, nil
+}
+
+func (s *storeTwoTier) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	err := s.remote.Set(ctx, key, value, ttl)
+	if err != nil {
+		return err
+	}
+	_ = s.local.Set(ctx, key, value, s.ttl(ttl))
+
+	return nil
+}
+
+func (s *storeTwoTier) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	ok, err := s.remote.SetNX(ctx, key, value, ttl)
+	if err != nil || !ok {
+		return ok, err
+	}
+	// The key may be deleted by another replica, so a local copy could report it as
+	// owned after it is released.
+	_ = s.local.Delete(ctx, key)
+
+	return true, nil
+}
+
+// Delete removes the key from the remote store and the local store of this replica,
+// the other replicas may still read it for up to localTTL.
+func (s *storeTwoTier) Delete(ctx context.Context, key string) error {
+	err := s.remote.Delete(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return s.local.Delete(ctx, key)
+}
+
+// CompareAndDelete compares the value in the remote store, which is the owner of the
+// keys taken by SetNX.
+func (s *storeTwoTier) CompareAndDelete(ctx context.Context, key string, value []byte) (bool, error) {
+	ok, err := CompareAndDelete(ctx, s.remote, key, value)
+	if err != nil || !ok {
+		return ok, err
+	}
+	_ = s.local.Delete(ctx, key)
+
+	return true, nil
+}
+
+func (s *storeTwoTier) Touch(ctx context.Context, key string, ttl time.Duration) error {
+	err := s.remote.Touch(ctx, key, ttl)
+	if err != nil {
+		return err
+	}
+
+	return s.local.Touch(ctx, key, s.ttl(ttl))
+}
+
+// ttl returns the ttl for the local store, which is never longer than localTTL.
+func (s *storeTwoTier) ttl(ttl time.Duration) time.Duration {
+	if ttl <= 0 || ttl > s.localTTL {
+		return s.localTTL
+	}
+
+	return ttl
+}
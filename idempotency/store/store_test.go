@@ -0,0 +1,227 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/clubpay/qlubkit-go/idempotency/store"
+	"github.com/redis/go-redis/v9"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testStore runs the common checks on s, wait is used to let the keys expire.
+func testStore(c C, s store.Store, wait func(time.Duration)) {
+	ctx := context.Background()
+
+	v, err := s.Get(ctx, "k1")
+	c.So(err, ShouldBeNil)
+	c.So(v, ShouldBeNil)
+
+	c.So(s.Set(ctx, "k1", []byte("v1"), time.Minute), ShouldBeNil)
+	v, err = s.Get(ctx, "k1")
+	c.So(err, ShouldBeNil)
+	c.So(v, ShouldResemble, []byte("v1"))
+
+	ok, err := s.SetNX(ctx, "k1", []byte("v2"), time.Minute)
+	c.So(err, ShouldBeNil)
+	c.So(ok, ShouldBeFalse)
+	ok, err = s.SetNX(ctx, "k2", []byte("v2"), time.Minute)
+	c.So(err, ShouldBeNil)
+	c.So(ok, ShouldBeTrue)
+
+	c.So(s.Touch(ctx, "k2", time.Hour), ShouldBeNil)
+	v, err = s.Get(ctx, "k2")
+	c.So(err, ShouldBeNil)
+	c.So(v, ShouldResemble, []byte("v2"))
+
+	c.So(s.Delete(ctx, "k1"), ShouldBeNil)
+	v, err = s.Get(ctx, "k1")
+	c.So(err, ShouldBeNil)
+	c.So(v, ShouldBeNil)
+
+	c.So(s.Set(ctx, "k4", []byte("v4"), time.Minute), ShouldBeNil)
+	ok, err = store.CompareAndDelete(ctx, s, "k4", []byte("v1"))
+	c.So(err, ShouldBeNil)
+	c.So(ok, ShouldBeFalse)
+	ok, err = store.CompareAndDelete(ctx, s, "k4", []byte("v4"))
+	c.So(err, ShouldBeNil)
+	c.So(ok, ShouldBeTrue)
+	v, err = s.Get(ctx, "k4")
+	c.So(err, ShouldBeNil)
+	c.So(v, ShouldBeNil)
+	ok, err = store.CompareAndDelete(ctx, s, "k4", []byte("v4"))
+	c.So(err, ShouldBeNil)
+	c.So(ok, ShouldBeFalse)
+
+	c.So(s.Set(ctx, "k3", []byte("v3"), 50*time.Millisecond), ShouldBeNil)
+	wait(100 * time.Millisecond)
+	v, err = s.Get(ctx, "k3")
+	c.So(err, ShouldBeNil)
+	c.So(v, ShouldBeNil)
+}
+
+func TestStore(t *testing.T) {
+	Convey("Store", t, func(c C) {
+		Convey("Ristretto", func(c C) {
+			testStore(c, store.NewRistretto(), time.Sleep)
+		})
+		Convey("Redis", func(c C) {
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			defer rdb.Close()
+			testStore(c, store.NewRedisStore(rdb), mr.FastForward)
+		})
+		Convey("Redis cluster", func(c C) {
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}})
+			defer rdb.Close()
+			testStore(c, store.NewRedisStore(rdb), mr.FastForward)
+		})
+		Convey("File", func(c C) {
+			fs, err := store.NewFileStore(t.TempDir())
+			c.So(err, ShouldBeNil)
+			testStore(c, fs, time.Sleep)
+
+			n, err := fs.Sweep(context.Background())
+			c.So(err, ShouldBeNil)
+			c.So(n, ShouldEqual, 0)
+		})
+		Convey("Two tier", func(c C) {
+			remote, err := store.NewFileStore(t.TempDir())
+			c.So(err, ShouldBeNil)
+			testStore(c, store.NewTwoTierStore(store.NewRistretto(), remote, time.Minute), time.Sleep)
+		})
+		Convey("Two tier reads through", func(c C) {
+			ctx := context.Background()
+			local := store.NewRistretto()
+			remote := store.NewRistretto()
+			s := store.NewTwoTierStore(local, remote, time.Minute)
+			c.So(remote.Set(ctx, "k1", []byte("v1"), time.Hour), ShouldBeNil)
+
+			v, err := s.Get(ctx, "k1")
+			c.So(err, ShouldBeNil)
+			c.So(v, ShouldResemble, []byte("v1"))
+			v, err = local.Get(ctx, "k1")
+			c.So(err, ShouldBeNil)
+			c.So(v, ShouldResemble, []byte("v1"))
+		})
+		Convey("Two tier staleness is bounded by the local ttl", func(c C) {
+			ctx := context.Background()
+			remote := store.NewRistretto()
+			a := store.NewTwoTierStore(store.NewRistretto(), remote, time.Minute)
+			b := store.NewTwoTierStore(store.NewRistretto(), remote, 50*time.Millisecond)
+
+			c.So(a.Set(ctx, "k1", []byte("v1"), time.Hour), ShouldBeNil)
+			v, err := b.Get(ctx, "k1")
+			c.So(err, ShouldBeNil)
+			c.So(v, ShouldResemble, []byte("v1"))
+
+			c.So(a.Delete(ctx, "k1"), ShouldBeNil)
+			v, err = b.Get(ctx, "k1")
+			c.So(err, ShouldBeNil)
+			c.So(v, ShouldResemble, []byte("v1"))
+
+			time.Sleep(60 * time.Millisecond)
+			v, err = b.Get(ctx, "k1")
+			c.So(err, ShouldBeNil)
+			c.So(v, ShouldBeNil)
+		})
+		Convey("Two tier SetNX is decided by the remote store", func(c C) {
+			ctx := context.Background()
+			remote := store.NewRistretto()
+			a := store.NewTwoTierStore(store.NewRistretto(), remote, time.Minute)
+			b := store.NewTwoTierStore(store.NewRistretto(), remote, time.Minute)
+
+			ok, err := a.SetNX(ctx, "lock", []byte("a"), time.Hour)
+			c.So(err, ShouldBeNil)
+			c.So(ok, ShouldBeTrue)
+			ok, err = b.SetNX(ctx, "lock", []byte("b"), time.Hour)
+			c.So(err, ShouldBeNil)
+			c.So(ok, ShouldBeFalse)
+
+			// b releases the lock, a must see it as free right away.
+			c.So(b.Delete(ctx, "lock"), ShouldBeNil)
+			v, err := a.Get(ctx, "lock")
+			c.So(err, ShouldBeNil)
+			c.So(v, ShouldBeNil)
+			ok, err = a.SetNX(ctx, "lock", []byte("a"), time.Hour)
+			c.So(err, ShouldBeNil)
+			c.So(ok, ShouldBeTrue)
+		})
+		Convey("Legacy adapter", func(c C) {
+			testStore(c, store.FromLegacy(&mapStore{m: map[string]entry{}}), time.Sleep)
+		})
+		Convey("Legacy adapters of the same store do not mix the ttls", func(c C) {
+			ctx := context.Background()
+			ms := &mapStore{m: map[string]entry{}}
+			short, long := store.FromLegacy(ms), store.FromLegacy(ms)
+
+			var wg sync.WaitGroup
+			for i := range 100 {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					_ = short.Set(ctx, fmt.Sprintf("s%d", i), []byte("v"), time.Millisecond)
+				}()
+				go func() {
+					defer wg.Done()
+					_ = long.Set(ctx, fmt.Sprintf("l%d", i), []byte("v"), time.Hour)
+				}()
+			}
+			wg.Wait()
+			time.Sleep(10 * time.Millisecond)
+
+			for i := range 100 {
+				v, err := long.Get(ctx, fmt.Sprintf("l%d", i))
+				c.So(err, ShouldBeNil)
+				c.So(v, ShouldResemble, []byte("v"))
+			}
+		})
+	})
+}
+
+type entry struct {
+	v   []byte
+	exp time.Time
+}
+
+// mapStore is a minimal LegacyStore implementation.
+type mapStore struct {
+	mtx sync.Mutex
+	ttl time.Duration
+	m   map[string]entry
+}
+
+func (s *mapStore) SetTTL(duration time.Duration) {
+	s.ttl = duration
+}
+
+func (s *mapStore) GetValue(key string) ([]byte, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	e, ok := s.m[key]
+	if !ok || (!e.exp.IsZero() && time.Now().After(e.exp)) {
+		return nil, nil
+	}
+
+	return e.v, nil
+}
+
+func (s *mapStore) SetValue(key string, value []byte) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	e := entry{v: value}
+	if s.ttl > 0 {
+		e.exp = time.Now().Add(s.ttl)
+	}
+	s.m[key] = e
+
+	return nil
+}
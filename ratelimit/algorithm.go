@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"errors"
+)
+
+var ErrUnsupportedAlgorithm = errors.New("ratelimit: operation is not supported by the algorithm")
+
+// Algorithm is the algorithm used to evaluate a Limit.
+type Algorithm int
+
+const (
+	// GCRA is the generic cell rate algorithm, a leaky bucket which allows Burst
+	// events at once and refills at Rate per Period.
+	GCRA Algorithm = iota
+	// FixedWindow allows Rate events in each window of Period. The windows are
+	// aligned to the unix epoch, e.g. a minute window starts at the beginning of the
+	// calendar minute. Burst is ignored.
+	FixedWindow
+	// SlidingWindowLog allows Rate events in any Period. It keeps the time of every
+	// event, so it is exact but its memory grows with Rate. Burst is ignored.
+	SlidingWindowLog
+	// SlidingWindowCounter allows about Rate events in any Period. It estimates the
+	// count from the counts of the current and the previous fixed windows. Burst is
+	// ignored.
+	SlidingWindowCounter
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case GCRA:
+		return "gcra"
+	case FixedWindow:
+		return "fixed_window"
+	case SlidingWindowLog:
+		return "sliding_window_log"
+	case SlidingWindowCounter:
+		return "sliding_window_counter"
+	}
+
+	return "unknown"
+}
+
+// WithAlgorithm returns a copy of the limit which uses the algorithm.
+func (l Limit) WithAlgorithm(a Algorithm) Limit {
+	l.Algorithm = a
+
+	return l
+}
+
+// capacity returns the maximum number of events allowed at once.
+func (l Limit) capacity() int {
+	if l.Algorithm == GCRA {
+		return l.Burst
+	}
+
+	return l.Rate
+}
+
+// windowMode is the operation run by the window algorithms.
+type windowMode int
+
+const (
+	windowAllowN windowMode = iota
+	windowAllowAtMost
+	windowInspect
+)
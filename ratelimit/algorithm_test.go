@@ -0,0 +1,162 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/clubpay/qlubkit-go/ratelimit"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWindowAlgorithms(t *testing.T) {
+	Convey("Window algorithms", t, func(c C) {
+		ctx := context.Background()
+		for name, b := range backends(t) {
+			Convey(name, func(c C) {
+				l := ratelimit.NewLimiterWithBackend(b)
+
+				Convey("FixedWindow", func(c C) {
+					limit := ratelimit.Limit{Rate: 3, Period: 24 * time.Hour, Algorithm: ratelimit.FixedWindow}
+
+					res, err := l.AllowN(ctx, "k", limit, 2)
+					c.So(err, ShouldBeNil)
+					c.So(res.Allowed, ShouldEqual, 2)
+					c.So(res.Remaining, ShouldEqual, 1)
+					c.So(res.RetryAfter, ShouldEqual, -1)
+					c.So(res.ResetAfter, ShouldBeBetweenOrEqual, 0, 24*time.Hour)
+
+					res, err = l.AllowN(ctx, "k", limit, 2)
+					c.So(err, ShouldBeNil)
+					c.So(res.Allowed, ShouldEqual, 0)
+					c.So(res.RetryAfter.Seconds(), ShouldAlmostEqual, res.ResetAfter.Seconds(), tolerance)
+
+					res, err = l.AllowAtMost(ctx, "k", limit, 2)
+					c.So(err, ShouldBeNil)
+					c.So(res.Allowed, ShouldEqual, 1)
+					c.So(res.Remaining, ShouldEqual, 0)
+
+					c.So(l.Reset(ctx, "k"), ShouldBeNil)
+					res, err = l.Allow(ctx, "k", limit)
+					c.So(err, ShouldBeNil)
+					c.So(res.Remaining, ShouldEqual, 2)
+				})
+
+				Convey("FixedWindow denies more than the limit with a retry", func(c C) {
+					limit := ratelimit.Limit{Rate: 3, Period: 24 * time.Hour, Algorithm: ratelimit.FixedWindow}
+
+					res, err := l.AllowN(ctx, "k", limit, 4)
+					c.So(err, ShouldBeNil)
+					c.So(res.Allowed, ShouldEqual, 0)
+					c.So(res.RetryAfter, ShouldBeGreaterThan, 0)
+					c.So(res.RetryAfter, ShouldBeLessThanOrEqualTo, 24*time.Hour)
+					c.So(res.ResetAfter, ShouldEqual, 0)
+				})
+
+				Convey("SlidingWindowLog", func(c C) {
+					limit := ratelimit.PerMinute(3).WithAlgorithm(ratelimit.SlidingWindowLog)
+					runSteps(c, l, "k", limit, []step{
+						{n: 2, res: ratelimit.Result{Allowed: 2, Remaining: 1, RetryAfter: -1, ResetAfter: time.Minute}},
+						{n: 2, res: ratelimit.Result{Allowed: 0, Remaining: 0, RetryAfter: time.Minute, ResetAfter: time.Minute}},
+						{n: 5, atMost: true, res: ratelimit.Result{Allowed: 1, Remaining: 0, RetryAfter: -1, ResetAfter: time.Minute}},
+						{n: 1, res: ratelimit.Result{Allowed: 0, Remaining: 0, RetryAfter: time.Minute, ResetAfter: time.Minute}},
+						{reset: true},
+						{n: 3, res: ratelimit.Result{Allowed: 3, Remaining: 0, RetryAfter: -1, ResetAfter: time.Minute}},
+					})
+				})
+
+				Convey("SlidingWindowLog slides", func(c C) {
+					limit := ratelimit.Limit{Rate: 2, Period: 100 * time.Millisecond, Algorithm: ratelimit.SlidingWindowLog}
+
+					res, err := l.AllowN(ctx, "k", limit, 2)
+					c.So(err, ShouldBeNil)
+					c.So(res.Allowed, ShouldEqual, 2)
+
+					res, err = l.Allow(ctx, "k", limit)
+					c.So(err, ShouldBeNil)
+					c.So(res.Allowed, ShouldEqual, 0)
+
+					time.Sleep(res.RetryAfter + 10*time.Millisecond)
+					res, err = l.Allow(ctx, "k", limit)
+					c.So(err, ShouldBeNil)
+					c.So(res.Allowed, ShouldEqual, 1)
+				})
+
+				Convey("SlidingWindowCounter", func(c C) {
+					limit := ratelimit.Limit{Rate: 4, Period: 24 * time.Hour, Algorithm: ratelimit.SlidingWindowCounter}
+
+					res, err := l.AllowN(ctx, "k", limit, 3)
+					c.So(err, ShouldBeNil)
+					c.So(res.Allowed, ShouldEqual, 3)
+					c.So(res.Remaining, ShouldEqual, 1)
+					c.So(res.ResetAfter, ShouldBeBetweenOrEqual, 24*time.Hour, 48*time.Hour)
+
+					res, err = l.AllowN(ctx, "k", limit, 2)
+					c.So(err, ShouldBeNil)
+					c.So(res.Allowed, ShouldEqual, 0)
+					c.So(res.RetryAfter.Seconds(), ShouldAlmostEqual, (res.ResetAfter - 16*time.Hour).Seconds(), tolerance)
+				})
+
+				Convey("Reserve is not supported", func(c C) {
+					limit := ratelimit.PerMinute(3).WithAlgorithm(ratelimit.FixedWindow)
+					_, err := l.Reserve(ctx, "k", limit, 1)
+					c.So(err, ShouldEqual, ratelimit.ErrUnsupportedAlgorithm)
+					_, err = l.AllowMulti(ctx, "k", []ratelimit.Limit{limit}, 1)
+					c.So(err, ShouldEqual, ratelimit.ErrUnsupportedAlgorithm)
+				})
+			})
+		}
+	})
+}
+
+func TestWindowAlgorithmsClock(t *testing.T) {
+	Convey("Window algorithms follow the clock", t, func(c C) {
+		ctx := context.Background()
+		now := time.Date(2026, 1, 1, 12, 0, 59, 500e6, time.UTC)
+		l := ratelimit.NewLimiterWithBackend(ratelimit.NewMemoryBackendWithClock(func() time.Time { return now }))
+
+		Convey("FixedWindow windows are calendar aligned", func(c C) {
+			limit := ratelimit.PerMinute(2).WithAlgorithm(ratelimit.FixedWindow)
+
+			res, err := l.AllowN(ctx, "k", limit, 2)
+			c.So(err, ShouldBeNil)
+			c.So(res.Allowed, ShouldEqual, 2)
+			c.So(res.ResetAfter, ShouldEqual, 500*time.Millisecond)
+
+			res, err = l.Allow(ctx, "k", limit)
+			c.So(err, ShouldBeNil)
+			c.So(res.Allowed, ShouldEqual, 0)
+			c.So(res.RetryAfter, ShouldEqual, 500*time.Millisecond)
+
+			now = now.Add(500 * time.Millisecond)
+			res, err = l.Allow(ctx, "k", limit)
+			c.So(err, ShouldBeNil)
+			c.So(res.Allowed, ShouldEqual, 1)
+			c.So(res.Remaining, ShouldEqual, 1)
+			c.So(res.ResetAfter, ShouldEqual, time.Minute)
+		})
+
+		Convey("SlidingWindowCounter weighs the previous window", func(c C) {
+			limit := ratelimit.PerMinute(10).WithAlgorithm(ratelimit.SlidingWindowCounter)
+			now = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+			res, err := l.AllowN(ctx, "k", limit, 10)
+			c.So(err, ShouldBeNil)
+			c.So(res.Allowed, ShouldEqual, 10)
+
+			// 75% of the sliding window overlaps the previous window.
+			now = now.Add(75 * time.Second)
+			res, err = l.AllowAtMost(ctx, "k", limit, 5)
+			c.So(err, ShouldBeNil)
+			c.So(res.Allowed, ShouldEqual, 2)
+			c.So(res.Remaining, ShouldEqual, 0)
+
+			res, err = l.Allow(ctx, "k", limit)
+			c.So(err, ShouldBeNil)
+			c.So(res.Allowed, ShouldEqual, 0)
+			c.So(res.RetryAfter, ShouldEqual, 3*time.Second)
+			c.So(res.ResetAfter, ShouldEqual, 105*time.Second)
+		})
+	})
+}
@@ -0,0 +1,33 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Backend keeps the state of the keys and evaluates the limits. All the backends
+// must return identical results for the same sequence of calls. Reserve, Cancel and
+// AllowMulti only support GCRA limits.
+type Backend interface {
+	// AllowN reports whether n events may happen at time now. It allows either all
+	// the n events or none of them.
+	AllowN(ctx context.Context, key string, limit Limit, n int) (*Result, error)
+	// AllowAtMost allows as many events as possible, up to n.
+	AllowAtMost(ctx context.Context, key string, limit Limit, n int) (*Result, error)
+	// Reserve books n events even if they are not allowed now, unless they would be
+	// allowed after maxWait; a negative maxWait means no limit. If the events are
+	// booked, Allowed is n and RetryAfter is the time until they can happen, or -1
+	// if they can happen now.
+	Reserve(ctx context.Context, key string, limit Limit, n int, maxWait time.Duration) (*Result, error)
+	// Cancel returns n events booked by Reserve.
+	Cancel(ctx context.Context, key string, limit Limit, n int) error
+	// AllowMulti reports whether n events may happen at time now under all the
+	// limits. It allows the events under all the limits or none of them.
+	AllowMulti(ctx context.Context, key string, limits []Limit, n int) (*MultiResult, error)
+	// Inspect reports the state of the key without consuming. Allowed is always 0,
+	// Remaining is the number of events which may happen now and RetryAfter is the
+	// time until one event may happen, or -1 if it may happen now.
+	Inspect(ctx context.Context, key string, limit Limit) (*Result, error)
+	// Reset removes the state of the key.
+	Reset(ctx context.Context, key string) error
+}
@@ -0,0 +1,172 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrLeaseExpired = errors.New("ratelimit: lease is expired or released")
+
+// defaultLeaseTTL is how long a lease is held if its holder neither releases nor
+// refreshes it.
+const defaultLeaseTTL = time.Minute
+
+// ConcurrencyBackend keeps the leases of the keys. All the backends must return
+// identical results for the same sequence of calls.
+type ConcurrencyBackend interface {
+	// Acquire adds the lease to the key unless the key already has maxInFlight
+	// unexpired leases. It returns whether the lease is added and the number of
+	// unexpired leases of the key, including the new one.
+	Acquire(ctx context.Context, key, leaseID string, maxInFlight int, ttl time.Duration) (bool, int, error)
+	// Refresh extends the lease by ttl. It returns false if the lease is expired or
+	// released.
+	Refresh(ctx context.Context, key, leaseID string, ttl time.Duration) (bool, error)
+	// Release removes the lease from the key.
+	Release(ctx context.Context, key, leaseID string) error
+}
+
+// ConcurrencyLimiter controls how many events are allowed to be in flight at the
+// same time, i.e. it is a distributed semaphore.
+type ConcurrencyLimiter struct {
+	backend  ConcurrencyBackend
+	leaseTTL time.Duration
+}
+
+type ConcurrencyOption func(l *ConcurrencyLimiter)
+
+// WithLeaseTTL sets how long a lease is held if its holder crashes before releasing
+// it. Long-running holders must refresh their leases before the ttl passes.
+// Defaults to one minute.
+func WithLeaseTTL(ttl time.Duration) ConcurrencyOption {
+	return func(l *ConcurrencyLimiter) {
+		l.leaseTTL = ttl
+	}
+}
+
+// NewConcurrencyLimiter returns a new ConcurrencyLimiter which keeps its leases in
+// Redis. rdb can be a single node, cluster or sentinel client.
+func NewConcurrencyLimiter(rdb redis.UniversalClient, opts ...ConcurrencyOption) *ConcurrencyLimiter {
+	return NewConcurrencyLimiterWithBackend(NewRedisConcurrencyBackend(rdb), opts...)
+}
+
+// NewConcurrencyLimiterWithBackend returns a new ConcurrencyLimiter which keeps its
+// leases in the backend.
+func NewConcurrencyLimiterWithBackend(backend ConcurrencyBackend, opts ...ConcurrencyOption) *ConcurrencyLimiter {
+	l := &ConcurrencyLimiter{
+		backend:  backend,
+		leaseTTL: defaultLeaseTTL,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+// Acquire tries to take one of the maxInFlight leases of the key. If it succeeds,
+// the lease in the result must be released when the event is done.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, key string, maxInFlight int) (*ConcurrencyResult, error) {
+	id, err := newLeaseID()
+	if err != nil {
+		return nil, err
+	}
+
+	acquired, inFlight, err := l.backend.Acquire(ctx, key, id, maxInFlight, l.leaseTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ConcurrencyResult{
+		InFlight: inFlight,
+		Max:      maxInFlight,
+	}
+	if acquired {
+		res.Lease = &Lease{
+			backend: l.backend,
+			key:     key,
+			id:      id,
+			ttl:     l.leaseTTL,
+		}
+	}
+
+	return res, nil
+}
+
+func newLeaseID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b[:]), nil
+}
+
+type ConcurrencyResult struct {
+	// Lease is the acquired lease, it is nil if the limit has been reached.
+	Lease *Lease
+
+	// InFlight is the number of leases held for the key, including the acquired one.
+	InFlight int
+
+	// Max is the maximum number of leases allowed for the key.
+	Max int
+}
+
+// Acquired reports whether a lease is acquired.
+func (r *ConcurrencyResult) Acquired() bool {
+	return r.Lease != nil
+}
+
+// Lease is one of the in-flight slots of a key.
+type Lease struct {
+	mtx      sync.Mutex
+	backend  ConcurrencyBackend
+	key      string
+	id       string
+	ttl      time.Duration
+	released bool
+}
+
+// Refresh extends the lease by the lease ttl. It returns ErrLeaseExpired if the
+// lease has already expired, in which case the slot may have been taken by others.
+func (l *Lease) Refresh(ctx context.Context) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.released {
+		return ErrLeaseExpired
+	}
+
+	ok, err := l.backend.Refresh(ctx, l.key, l.id, l.ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLeaseExpired
+	}
+
+	return nil
+}
+
+// Release gives the slot back. It is safe to call it more than once.
+func (l *Lease) Release(ctx context.Context) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.released {
+		return nil
+	}
+
+	if err := l.backend.Release(ctx, l.key, l.id); err != nil {
+		return err
+	}
+	l.released = true
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryConcurrencyBackend struct {
+	mtx    sync.Mutex
+	now    func() time.Time
+	leases map[string]map[string]time.Time
+}
+
+var _ ConcurrencyBackend = (*memoryConcurrencyBackend)(nil)
+
+// NewMemoryConcurrencyBackend returns a ConcurrencyBackend which keeps the leases in
+// the process memory. It is useful for tests and single instance tools, the leases
+// are not shared between processes.
+func NewMemoryConcurrencyBackend() ConcurrencyBackend {
+	return newMemoryConcurrencyBackend(time.Now)
+}
+
+func newMemoryConcurrencyBackend(now func() time.Time) *memoryConcurrencyBackend {
+	return &memoryConcurrencyBackend{
+		now:    now,
+		leases: make(map[string]map[string]time.Time),
+	}
+}
+
+// Acquire is the Go port of lua/acquire.lua.
+func (b *memoryConcurrencyBackend) Acquire(
+	_ context.Context,
+	key, leaseID string,
+	maxInFlight int,
+	ttl time.Duration,
+) (bool, int, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	now := b.now()
+	leases := b.live(key, now)
+	if len(leases) >= maxInFlight {
+		return false, len(leases), nil
+	}
+
+	if leases == nil {
+		leases = make(map[string]time.Time)
+		b.leases[key] = leases
+	}
+	leases[leaseID] = now.Add(ttl)
+
+	return true, len(leases), nil
+}
+
+// Refresh is the Go port of lua/refresh.lua.
+func (b *memoryConcurrencyBackend) Refresh(
+	_ context.Context,
+	key, leaseID string,
+	ttl time.Duration,
+) (bool, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	now := b.now()
+	leases := b.live(key, now)
+	if _, ok := leases[leaseID]; !ok {
+		return false, nil
+	}
+	leases[leaseID] = now.Add(ttl)
+
+	return true, nil
+}
+
+func (b *memoryConcurrencyBackend) Release(_ context.Context, key, leaseID string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	leases := b.leases[key]
+	delete(leases, leaseID)
+	if len(leases) == 0 {
+		delete(b.leases, key)
+	}
+
+	return nil
+}
+
+// live drops the expired leases of the key and returns the remaining ones.
+func (b *memoryConcurrencyBackend) live(key string, now time.Time) map[string]time.Time {
+	leases := b.leases[key]
+	for id, expireAt := range leases {
+		if !now.Before(expireAt) {
+			delete(leases, id)
+		}
+	}
+	if len(leases) == 0 {
+		delete(b.leases, key)
+
+		return nil
+	}
+
+	return leases
+}
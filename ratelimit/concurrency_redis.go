@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type redisConcurrencyBackend struct {
+	rdb redis.UniversalClient
+}
+
+var _ ConcurrencyBackend = (*redisConcurrencyBackend)(nil)
+
+// NewRedisConcurrencyBackend returns a ConcurrencyBackend which keeps the leases of
+// each key in a Redis sorted set, hence they are shared by all the instances using
+// the same Redis. rdb can be a single node, cluster or sentinel client.
+func NewRedisConcurrencyBackend(rdb redis.UniversalClient) ConcurrencyBackend {
+	return &redisConcurrencyBackend{
+		rdb: rdb,
+	}
+}
+
+func (b *redisConcurrencyBackend) Acquire(
+	ctx context.Context,
+	key, leaseID string,
+	maxInFlight int,
+	ttl time.Duration,
+) (bool, int, error) {
+	v, err := luaAcquire.Run(ctx, b.rdb, []string{key}, maxInFlight, leaseID, ttl.Milliseconds()).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+
+	return v[0] == 1, int(v[1]), nil
+}
+
+func (b *redisConcurrencyBackend) Refresh(
+	ctx context.Context,
+	key, leaseID string,
+	ttl time.Duration,
+) (bool, error) {
+	v, err := luaRefresh.Run(ctx, b.rdb, []string{key}, leaseID, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return v == 1, nil
+}
+
+func (b *redisConcurrencyBackend) Release(ctx context.Context, key, leaseID string) error {
+	return b.rdb.ZRem(ctx, key, leaseID).Err()
+}
@@ -0,0 +1,89 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/clubpay/qlubkit-go/ratelimit"
+	"github.com/redis/go-redis/v9"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func concurrencyBackends(t *testing.T) map[string]ratelimit.ConcurrencyBackend {
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	crdb := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{miniredis.RunT(t).Addr()}})
+	t.Cleanup(func() { _ = crdb.Close() })
+
+	return map[string]ratelimit.ConcurrencyBackend{
+		"Memory":       ratelimit.NewMemoryConcurrencyBackend(),
+		"Redis":        ratelimit.NewRedisConcurrencyBackend(rdb),
+		"RedisCluster": ratelimit.NewRedisConcurrencyBackend(crdb),
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	Convey("ConcurrencyLimiter", t, func(c C) {
+		ctx := context.Background()
+		for name, b := range concurrencyBackends(t) {
+			Convey(name, func(c C) {
+				Convey("Acquire and Release", func(c C) {
+					l := ratelimit.NewConcurrencyLimiterWithBackend(b)
+
+					res1, err := l.Acquire(ctx, "k", 2)
+					c.So(err, ShouldBeNil)
+					c.So(res1.Acquired(), ShouldBeTrue)
+					c.So(res1.InFlight, ShouldEqual, 1)
+					c.So(res1.Max, ShouldEqual, 2)
+
+					res2, err := l.Acquire(ctx, "k", 2)
+					c.So(err, ShouldBeNil)
+					c.So(res2.Acquired(), ShouldBeTrue)
+					c.So(res2.InFlight, ShouldEqual, 2)
+
+					res, err := l.Acquire(ctx, "k", 2)
+					c.So(err, ShouldBeNil)
+					c.So(res.Acquired(), ShouldBeFalse)
+					c.So(res.InFlight, ShouldEqual, 2)
+
+					res, err = l.Acquire(ctx, "other", 2)
+					c.So(err, ShouldBeNil)
+					c.So(res.Acquired(), ShouldBeTrue)
+
+					c.So(res1.Lease.Release(ctx), ShouldBeNil)
+					c.So(res1.Lease.Release(ctx), ShouldBeNil)
+					c.So(res1.Lease.Refresh(ctx), ShouldEqual, ratelimit.ErrLeaseExpired)
+
+					res, err = l.Acquire(ctx, "k", 2)
+					c.So(err, ShouldBeNil)
+					c.So(res.Acquired(), ShouldBeTrue)
+					c.So(res.InFlight, ShouldEqual, 2)
+				})
+
+				Convey("Leases of crashed holders expire", func(c C) {
+					l := ratelimit.NewConcurrencyLimiterWithBackend(b, ratelimit.WithLeaseTTL(100*time.Millisecond))
+
+					res1, err := l.Acquire(ctx, "k", 2)
+					c.So(err, ShouldBeNil)
+					res2, err := l.Acquire(ctx, "k", 2)
+					c.So(err, ShouldBeNil)
+					c.So(res2.Acquired(), ShouldBeTrue)
+
+					time.Sleep(60 * time.Millisecond)
+					c.So(res2.Lease.Refresh(ctx), ShouldBeNil)
+					time.Sleep(60 * time.Millisecond)
+
+					// The first lease is expired, the refreshed one is still held.
+					c.So(res1.Lease.Refresh(ctx), ShouldEqual, ratelimit.ErrLeaseExpired)
+					res, err := l.Acquire(ctx, "k", 2)
+					c.So(err, ShouldBeNil)
+					c.So(res.Acquired(), ShouldBeTrue)
+					c.So(res.InFlight, ShouldEqual, 2)
+				})
+			})
+		}
+	})
+}
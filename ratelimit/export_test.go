@@ -0,0 +1,15 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+var (
+	HashTag = hashTag
+	SlotKey = slotKey
+)
+
+// NewMemoryBackendWithClock returns a memory backend which reads the time from now.
+func NewMemoryBackendWithClock(now func() time.Time) Backend {
+	return newMemoryBackend(now)
+}
@@ -0,0 +1,210 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// FailurePolicy decides what the Limiter does when the backend fails.
+type FailurePolicy int
+
+const (
+	// ReturnError returns the error of the backend to the caller.
+	ReturnError FailurePolicy = iota
+	// FailOpen allows the events.
+	FailOpen
+	// FailClosed denies the events.
+	FailClosed
+	// FallbackLocal evaluates the limit by a local backend, which is the memory
+	// backend unless set by WithFallbackBackend. The local limits are per process,
+	// so they are not shared with the other instances.
+	FallbackLocal
+)
+
+type LimiterOption func(l *Limiter)
+
+// WithFailurePolicy sets what AllowN, AllowAtMost and AllowMulti do when the
+// backend fails. Defaults to ReturnError.
+func WithFailurePolicy(p FailurePolicy) LimiterOption {
+	return func(l *Limiter) {
+		l.failurePolicy = p
+	}
+}
+
+// WithFallbackBackend sets the backend used by the FallbackLocal policy.
+func WithFallbackBackend(b Backend) LimiterOption {
+	return func(l *Limiter) {
+		l.fallback = b
+	}
+}
+
+// WithErrorHandler sets a function which is called with the errors of the backend
+// which are handled by the failure policy, e.g. to log them.
+func WithErrorHandler(fn func(ctx context.Context, key string, err error)) LimiterOption {
+	return func(l *Limiter) {
+		l.onError = fn
+	}
+}
+
+// WithDenialCache caches up to size denied keys in the process memory until their
+// RetryAfter passes, so the requests of a key which is known to be over its limit
+// are denied without calling the backend. It cuts the backend load during abuse
+// spikes, but the events returned to the limiter by Reservation.Cancel or Reset by
+// other instances are not seen until the cached RetryAfter passes.
+func WithDenialCache(size int) LimiterOption {
+	return func(l *Limiter) {
+		l.denials = newDenialCache(size, time.Now)
+	}
+}
+
+// failed applies the failure policy to the error of the backend, retry evaluates
+// the limit by the given backend.
+func (l Limiter) failed(
+	ctx context.Context,
+	key string,
+	limit Limit,
+	n int,
+	err error,
+	retry func(b Backend) (*Result, error),
+) (*Result, error) {
+	switch l.failurePolicy {
+	case FailOpen, FailClosed:
+		l.handleError(ctx, key, err)
+
+		return l.policyResult(limit, n), nil
+	case FallbackLocal:
+		l.handleError(ctx, key, err)
+
+		return retry(l.fallback)
+	}
+
+	return nil, err
+}
+
+func (l Limiter) handleError(ctx context.Context, key string, err error) {
+	if l.onError != nil {
+		l.onError(ctx, key, err)
+	}
+}
+
+// policyResult returns the result of the FailOpen and FailClosed policies.
+func (l Limiter) policyResult(limit Limit, n int) *Result {
+	if l.failurePolicy == FailOpen {
+		return &Result{
+			Limit:      limit,
+			Allowed:    n,
+			Remaining:  0,
+			RetryAfter: -1,
+			ResetAfter: 0,
+		}
+	}
+
+	return &Result{
+		Limit:      limit,
+		Allowed:    0,
+		Remaining:  0,
+		RetryAfter: limit.Period / time.Duration(max(limit.Rate, 1)),
+		ResetAfter: limit.Period,
+	}
+}
+
+//------------------------------------------------------------------------------
+
+type denialKey struct {
+	key   string
+	limit Limit
+}
+
+type denial struct {
+	n       int
+	retryAt time.Time
+	resetAt time.Time
+}
+
+// denialCache keeps the denied keys until their RetryAfter passes.
+type denialCache struct {
+	mtx  sync.Mutex
+	now  func() time.Time
+	size int
+	m    map[denialKey]denial
+}
+
+func newDenialCache(size int, now func() time.Time) *denialCache {
+	return &denialCache{
+		now:  now,
+		size: size,
+		m:    make(map[denialKey]denial),
+	}
+}
+
+// get returns the cached denial of n events of the key. A denial of n events also
+// denies more than n events.
+func (c *denialCache) get(key string, limit Limit, n int) (*Result, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	k := denialKey{key: key, limit: limit}
+	d, ok := c.m[k]
+	if !ok {
+		return nil, false
+	}
+
+	now := c.now()
+	if !now.Before(d.retryAt) {
+		delete(c.m, k)
+
+		return nil, false
+	}
+	if n < d.n {
+		return nil, false
+	}
+
+	return &Result{
+		Limit:      limit,
+		Allowed:    0,
+		Remaining:  0,
+		RetryAfter: d.retryAt.Sub(now),
+		ResetAfter: max(d.resetAt.Sub(now), 0),
+	}, true
+}
+
+// add caches the result if n events are denied.
+func (c *denialCache) add(key string, n int, res *Result) {
+	if res.Allowed > 0 || res.RetryAfter <= 0 {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := c.now()
+	if len(c.m) >= c.size {
+		for k, d := range c.m {
+			if !now.Before(d.retryAt) {
+				delete(c.m, k)
+			}
+		}
+		if len(c.m) >= c.size {
+			return
+		}
+	}
+
+	c.m[denialKey{key: key, limit: res.Limit}] = denial{
+		n:       n,
+		retryAt: now.Add(res.RetryAfter),
+		resetAt: now.Add(res.ResetAfter),
+	}
+}
+
+// remove drops the cached denials of the key.
+func (c *denialCache) remove(key string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for k := range c.m {
+		if k.key == key {
+			delete(c.m, k)
+		}
+	}
+}
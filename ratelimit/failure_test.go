@@ -0,0 +1,183 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/clubpay/qlubkit-go/ratelimit"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var errBackend = errors.New("backend is down")
+
+// failingBackend fails all the calls while down is set, and counts the calls.
+type failingBackend struct {
+	ratelimit.Backend
+	down  atomic.Bool
+	calls atomic.Int32
+}
+
+func newFailingBackend() *failingBackend {
+	return &failingBackend{Backend: ratelimit.NewMemoryBackend()}
+}
+
+func (b *failingBackend) AllowN(ctx context.Context, key string, limit ratelimit.Limit, n int) (*ratelimit.Result, error) {
+	b.calls.Add(1)
+	if b.down.Load() {
+		return nil, errBackend
+	}
+
+	return b.Backend.AllowN(ctx, key, limit, n)
+}
+
+func (b *failingBackend) AllowAtMost(ctx context.Context, key string, limit ratelimit.Limit, n int) (*ratelimit.Result, error) {
+	b.calls.Add(1)
+	if b.down.Load() {
+		return nil, errBackend
+	}
+
+	return b.Backend.AllowAtMost(ctx, key, limit, n)
+}
+
+func (b *failingBackend) AllowMulti(ctx context.Context, key string, limits []ratelimit.Limit, n int) (*ratelimit.MultiResult, error) {
+	b.calls.Add(1)
+	if b.down.Load() {
+		return nil, errBackend
+	}
+
+	return b.Backend.AllowMulti(ctx, key, limits, n)
+}
+
+func TestFailurePolicy(t *testing.T) {
+	Convey("Failure policy", t, func(c C) {
+		ctx := context.Background()
+		limit := ratelimit.PerMinute(2)
+		b := newFailingBackend()
+		b.down.Store(true)
+
+		Convey("ReturnError", func(c C) {
+			l := ratelimit.NewLimiterWithBackend(b)
+			_, err := l.Allow(ctx, "k", limit)
+			c.So(err, ShouldEqual, errBackend)
+			_, err = l.AllowMulti(ctx, "k", []ratelimit.Limit{limit}, 1)
+			c.So(err, ShouldEqual, errBackend)
+		})
+
+		Convey("FailOpen", func(c C) {
+			var handled []error
+			l := ratelimit.NewLimiterWithBackend(
+				b,
+				ratelimit.WithFailurePolicy(ratelimit.FailOpen),
+				ratelimit.WithErrorHandler(func(_ context.Context, key string, err error) {
+					c.So(key, ShouldEqual, "k")
+					handled = append(handled, err)
+				}),
+			)
+			res, err := l.AllowN(ctx, "k", limit, 5)
+			c.So(err, ShouldBeNil)
+			c.So(res.Allowed, ShouldEqual, 5)
+			c.So(res.RetryAfter, ShouldEqual, -1)
+
+			mres, err := l.AllowMulti(ctx, "k", []ratelimit.Limit{limit, ratelimit.PerHour(1)}, 1)
+			c.So(err, ShouldBeNil)
+			c.So(mres.Allowed, ShouldEqual, 1)
+			c.So(mres.Results, ShouldHaveLength, 2)
+			c.So(handled, ShouldResemble, []error{errBackend, errBackend})
+		})
+
+		Convey("FailClosed", func(c C) {
+			l := ratelimit.NewLimiterWithBackend(b, ratelimit.WithFailurePolicy(ratelimit.FailClosed))
+			res, err := l.Allow(ctx, "k", limit)
+			c.So(err, ShouldBeNil)
+			c.So(res.Allowed, ShouldEqual, 0)
+			c.So(res.RetryAfter, ShouldEqual, 30*time.Second)
+		})
+
+		Convey("FailClosed denials are not cached", func(c C) {
+			l := ratelimit.NewLimiterWithBackend(b,
+				ratelimit.WithFailurePolicy(ratelimit.FailClosed),
+				ratelimit.WithDenialCache(10),
+			)
+			res, err := l.Allow(ctx, "k", limit)
+			c.So(err, ShouldBeNil)
+			c.So(res.Allowed, ShouldEqual, 0)
+
+			// The backend is back.
+			b.down.Store(false)
+			res, err = l.Allow(ctx, "k", limit)
+			c.So(err, ShouldBeNil)
+			c.So(res.Allowed, ShouldEqual, 1)
+			c.So(b.calls.Load(), ShouldEqual, 2)
+		})
+
+		Convey("FallbackLocal", func(c C) {
+			l := ratelimit.NewLimiterWithBackend(b, ratelimit.WithFailurePolicy(ratelimit.FallbackLocal))
+			res, err := l.AllowN(ctx, "k", limit, 2)
+			c.So(err, ShouldBeNil)
+			c.So(res.Allowed, ShouldEqual, 2)
+
+			res, err = l.AllowAtMost(ctx, "k", limit, 2)
+			c.So(err, ShouldBeNil)
+			c.So(res.Allowed, ShouldEqual, 0)
+
+			// The backend is back.
+			b.down.Store(false)
+			res, err = l.AllowN(ctx, "k", limit, 2)
+			c.So(err, ShouldBeNil)
+			c.So(res.Allowed, ShouldEqual, 2)
+		})
+	})
+}
+
+func TestDenialCache(t *testing.T) {
+	Convey("Denial cache", t, func(c C) {
+		ctx := context.Background()
+		limit := ratelimit.Limit{Rate: 10, Period: time.Second, Burst: 2}
+		b := newFailingBackend()
+		l := ratelimit.NewLimiterWithBackend(b, ratelimit.WithDenialCache(10))
+
+		res, err := l.AllowN(ctx, "k", limit, 2)
+		c.So(err, ShouldBeNil)
+		c.So(res.Allowed, ShouldEqual, 2)
+
+		res, err = l.Allow(ctx, "k", limit)
+		c.So(err, ShouldBeNil)
+		c.So(res.Allowed, ShouldEqual, 0)
+		c.So(b.calls.Load(), ShouldEqual, 2)
+
+		// The denial is served from the cache until RetryAfter passes.
+		for range 5 {
+			res, err = l.Allow(ctx, "k", limit)
+			c.So(err, ShouldBeNil)
+			c.So(res.Allowed, ShouldEqual, 0)
+			c.So(res.RetryAfter, ShouldBeBetweenOrEqual, 0, 100*time.Millisecond)
+		}
+		res, err = l.AllowAtMost(ctx, "k", limit, 3)
+		c.So(err, ShouldBeNil)
+		c.So(res.Allowed, ShouldEqual, 0)
+		c.So(b.calls.Load(), ShouldEqual, 2)
+
+		// Other keys are not affected.
+		res, err = l.Allow(ctx, "other", limit)
+		c.So(err, ShouldBeNil)
+		c.So(res.Allowed, ShouldEqual, 1)
+		c.So(b.calls.Load(), ShouldEqual, 3)
+
+		time.Sleep(110 * time.Millisecond)
+		res, err = l.Allow(ctx, "k", limit)
+		c.So(err, ShouldBeNil)
+		c.So(res.Allowed, ShouldEqual, 1)
+		c.So(b.calls.Load(), ShouldEqual, 4)
+
+		// Reset drops the cached denials.
+		_, _ = l.AllowN(ctx, "k", limit, 2)
+		c.So(l.Reset(ctx, "k"), ShouldBeNil)
+		res, err = l.Allow(ctx, "k", limit)
+		c.So(err, ShouldBeNil)
+		c.So(res.Allowed, ShouldEqual, 1)
+	})
+}
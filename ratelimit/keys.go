@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// hashTag returns the part of the key which Redis Cluster uses to pick the slot,
+// i.e. the content of the first non-empty {...}, or the whole key.
+func hashTag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return key
+	}
+
+	return key[start+1 : start+1+end]
+}
+
+// slotKey derives a key from key with the given suffix which is guaranteed to be in
+// the same Redis Cluster slot as the other keys derived from key, so multi-key
+// scripts can run on them. If key already has a hash tag it is kept, otherwise the
+// whole key is used as the tag. Keys containing braces cannot be wrapped safely, so
+// a hash of the key is used as the tag instead.
+func slotKey(key, suffix string) string {
+	if hashTag(key) != key {
+		return key + ":" + suffix
+	}
+	if !strings.ContainsAny(key, "{}") {
+		return "{" + key + "}:" + suffix
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+
+	return "{" + strconv.FormatUint(h.Sum64(), 16) + "}:" + key + ":" + suffix
+}
@@ -11,14 +11,51 @@ var (
 	luaAllowNScript string
 	//go:embed lua/allow_atmost_n.lua
 	luaAllowAtMostScript string
+	//go:embed lua/reserve_n.lua
+	luaReserveNScript string
+	//go:embed lua/cancel_n.lua
+	luaCancelNScript string
+	//go:embed lua/allow_multi.lua
+	luaAllowMultiScript string
+	//go:embed lua/acquire.lua
+	luaAcquireScript string
+	//go:embed lua/refresh.lua
+	luaRefreshScript string
+	//go:embed lua/fixed_window.lua
+	luaFixedWindowScript string
+	//go:embed lua/sliding_log.lua
+	luaSlidingLogScript string
+	//go:embed lua/sliding_counter.lua
+	luaSlidingCounterScript string
+	//go:embed lua/inspect.lua
+	luaInspectScript string
 )
 
 var (
 	luaAllowN      *redis.Script
 	luaAllowAtMost *redis.Script
+	luaReserveN    *redis.Script
+	luaCancelN     *redis.Script
+	luaAllowMulti  *redis.Script
+	luaAcquire     *redis.Script
+	luaRefresh     *redis.Script
+	luaInspect     *redis.Script
+
+	luaFixedWindow    *redis.Script
+	luaSlidingLog     *redis.Script
+	luaSlidingCounter *redis.Script
 )
 
 func init() {
 	luaAllowN = redis.NewScript(luaAllowNScript)
 	luaAllowAtMost = redis.NewScript(luaAllowAtMostScript)
+	luaReserveN = redis.NewScript(luaReserveNScript)
+	luaCancelN = redis.NewScript(luaCancelNScript)
+	luaAllowMulti = redis.NewScript(luaAllowMultiScript)
+	luaAcquire = redis.NewScript(luaAcquireScript)
+	luaRefresh = redis.NewScript(luaRefreshScript)
+	luaInspect = redis.NewScript(luaInspectScript)
+	luaFixedWindow = redis.NewScript(luaFixedWindowScript)
+	luaSlidingLog = redis.NewScript(luaSlidingLogScript)
+	luaSlidingCounter = redis.NewScript(luaSlidingCounterScript)
 }
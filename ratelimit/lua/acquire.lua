@@ -0,0 +1,28 @@
+-- this script has side-effects, so it requires replicate commands mode
+redis.replicate_commands()
+
+-- the leases of the key are kept in a sorted set, scored by their expiry time in
+-- milliseconds, so the leases of crashed holders are dropped when they expire.
+local key = KEYS[1]
+local max_in_flight = tonumber(ARGV[1])
+local lease_id = ARGV[2]
+local ttl = tonumber(ARGV[3])
+
+local now = redis.call("TIME")
+now = now[1] * 1000 + math.floor(now[2] / 1000)
+
+redis.call("ZREMRANGEBYSCORE", key, "-inf", now)
+local in_flight = redis.call("ZCARD", key)
+
+if in_flight >= max_in_flight then
+  return {0, in_flight}
+end
+
+local expire_at = now + ttl
+redis.call("ZADD", key, expire_at, lease_id)
+
+-- the key lives as long as its longest lease.
+local last = redis.call("ZRANGE", key, -1, -1, "WITHSCORES")
+redis.call("PEXPIRE", key, math.max(tonumber(last[2]) - now, 1))
+
+return {1, in_flight + 1}
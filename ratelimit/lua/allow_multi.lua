@@ -0,0 +1,85 @@
+-- this script has side-effects, so it requires replicate commands mode
+redis.replicate_commands()
+
+-- every key has its own limit: ARGV[1] is the cost, followed by burst, rate and
+-- period of each key in the order of KEYS.
+local cost = tonumber(ARGV[1])
+
+-- see allow_n.lua for the epoch adjustment.
+local jan_1_2017 = 1483228800
+local now = redis.call("TIME")
+now = (now[1] - jan_1_2017) + (now[2] / 1000000)
+
+local windows = {}
+local allowed = true
+for i, key in ipairs(KEYS) do
+  local burst = tonumber(ARGV[i * 3 - 1])
+  local rate = tonumber(ARGV[i * 3])
+  local period = tonumber(ARGV[i * 3 + 1])
+
+  local emission_interval = period / rate
+  local burst_offset = emission_interval * burst
+
+  local tat = redis.call("GET", key)
+  if not tat then
+    tat = now
+  else
+    tat = tonumber(tat)
+  end
+  tat = math.max(tat, now)
+
+  local new_tat = tat + emission_interval * cost
+  local diff = now - (new_tat - burst_offset)
+  local remaining = diff / emission_interval
+  if remaining < 0 then
+    allowed = false
+  end
+
+  windows[i] = {
+    tat = tat,
+    new_tat = new_tat,
+    diff = diff,
+    remaining = remaining,
+    available = (now - (tat - burst_offset)) / emission_interval,
+  }
+end
+
+-- the result has the allowed events and the binding window (1-based), followed by
+-- remaining, retry_after and reset_after of each window. if the events are denied,
+-- nothing is consumed and the binding window is the one with the longest wait,
+-- otherwise it is the one with the least remaining.
+local result = {0, 0}
+local binding = nil
+for i, key in ipairs(KEYS) do
+  local w = windows[i]
+  if allowed then
+    local reset_after = w.new_tat - now
+    if reset_after > 0 then
+      redis.call("SET", key, w.new_tat, "EX", math.ceil(reset_after))
+    end
+    if binding == nil or w.remaining < windows[binding].remaining then
+      binding = i
+    end
+    table.insert(result, w.remaining)
+    table.insert(result, tostring(-1))
+    table.insert(result, tostring(reset_after))
+  elseif w.remaining < 0 then
+    if binding == nil or w.diff < windows[binding].diff then
+      binding = i
+    end
+    table.insert(result, 0)
+    table.insert(result, tostring(-w.diff))
+    table.insert(result, tostring(w.tat - now))
+  else
+    table.insert(result, w.available)
+    table.insert(result, tostring(-1))
+    table.insert(result, tostring(w.tat - now))
+  end
+end
+
+if allowed then
+  result[1] = cost
+end
+result[2] = binding
+
+return result
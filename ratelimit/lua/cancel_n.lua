@@ -0,0 +1,30 @@
+-- this script has side-effects, so it requires replicate commands mode
+redis.replicate_commands()
+
+local rate_limit_key = KEYS[1]
+local rate = ARGV[1]
+local period = ARGV[2]
+local cost = tonumber(ARGV[3])
+
+local emission_interval = period / rate
+local increment = emission_interval * cost
+
+-- see allow_n.lua for the epoch adjustment.
+local jan_1_2017 = 1483228800
+local now = redis.call("TIME")
+now = (now[1] - jan_1_2017) + (now[2] / 1000000)
+
+local tat = redis.call("GET", rate_limit_key)
+if not tat then
+  return 0
+end
+
+local new_tat = tonumber(tat) - increment
+local reset_after = new_tat - now
+if reset_after > 0 then
+  redis.call("SET", rate_limit_key, new_tat, "EX", math.ceil(reset_after))
+else
+  redis.call("DEL", rate_limit_key)
+end
+
+return 1
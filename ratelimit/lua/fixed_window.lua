@@ -0,0 +1,54 @@
+-- this script has side-effects, so it requires replicate commands mode
+redis.replicate_commands()
+
+local key = KEYS[1]
+local rate = tonumber(ARGV[1])
+local period = tonumber(ARGV[2]) -- milliseconds
+local cost = tonumber(ARGV[3])
+local at_most = ARGV[4] == "1"
+local inspect = ARGV[5] == "1"
+
+local now = redis.call("TIME")
+now = now[1] * 1000 + math.floor(now[2] / 1000)
+
+-- the windows are aligned to the unix epoch, so e.g. a minute window starts at the
+-- beginning of the calendar minute. the key keeps the window it counts, so a stale
+-- count is never used even if the key outlives its window.
+local window = math.floor(now / period)
+local window_end = (window + 1) * period
+local reset_after = window_end - now
+
+local state = redis.call("HMGET", key, "w", "c")
+local count = 0
+if tonumber(state[1]) == window then
+  count = tonumber(state[2])
+end
+
+if count == 0 then
+  reset_after = 0
+end
+
+local remaining = rate - count
+if at_most then
+  cost = math.min(cost, remaining)
+end
+
+-- inspect only reports the state of the key.
+if inspect and remaining > 0 then
+  return {0, remaining, tostring(-1), tostring(reset_after / 1000)}
+end
+
+if remaining <= 0 or cost > remaining then
+  local retry_after = window_end - now
+  return {
+    0, -- allowed
+    0, -- remaining
+    tostring(retry_after / 1000),
+    tostring(reset_after / 1000),
+  }
+end
+
+redis.call("HSET", key, "w", window, "c", count + cost)
+redis.call("PEXPIREAT", key, window_end)
+
+return {cost, remaining - cost, tostring(-1), tostring((window_end - now) / 1000)}
@@ -0,0 +1,33 @@
+-- this script is read-only, it reports the state of the key without consuming.
+local rate_limit_key = KEYS[1]
+local burst = ARGV[1]
+local rate = ARGV[2]
+local period = ARGV[3]
+
+local emission_interval = period / rate
+local burst_offset = emission_interval * burst
+
+-- see allow_n.lua for the epoch adjustment.
+local jan_1_2017 = 1483228800
+local now = redis.call("TIME")
+now = (now[1] - jan_1_2017) + (now[2] / 1000000)
+
+local tat = redis.call("GET", rate_limit_key)
+
+if not tat then
+  tat = now
+else
+  tat = tonumber(tat)
+end
+
+tat = math.max(tat, now)
+
+local diff = now - (tat - burst_offset)
+local remaining = diff / emission_interval
+local reset_after = tat - now
+
+if remaining < 1 then
+  return {0, 0, tostring(emission_interval - diff), tostring(reset_after)}
+end
+
+return {0, remaining, tostring(-1), tostring(reset_after)}
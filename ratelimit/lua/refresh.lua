@@ -0,0 +1,22 @@
+-- this script has side-effects, so it requires replicate commands mode
+redis.replicate_commands()
+
+local key = KEYS[1]
+local lease_id = ARGV[1]
+local ttl = tonumber(ARGV[2])
+
+local now = redis.call("TIME")
+now = now[1] * 1000 + math.floor(now[2] / 1000)
+
+local expire_at = redis.call("ZSCORE", key, lease_id)
+if not expire_at or tonumber(expire_at) <= now then
+  redis.call("ZREM", key, lease_id)
+  return 0
+end
+
+redis.call("ZADD", key, now + ttl, lease_id)
+
+local last = redis.call("ZRANGE", key, -1, -1, "WITHSCORES")
+redis.call("PEXPIRE", key, math.max(tonumber(last[2]) - now, 1))
+
+return 1
@@ -0,0 +1,55 @@
+-- this script has side-effects, so it requires replicate commands mode
+redis.replicate_commands()
+
+local rate_limit_key = KEYS[1]
+local burst = ARGV[1]
+local rate = ARGV[2]
+local period = ARGV[3]
+local cost = tonumber(ARGV[4])
+local max_wait = tonumber(ARGV[5])
+
+local emission_interval = period / rate
+local increment = emission_interval * cost
+local burst_offset = emission_interval * burst
+
+-- see allow_n.lua for the epoch adjustment.
+local jan_1_2017 = 1483228800
+local now = redis.call("TIME")
+now = (now[1] - jan_1_2017) + (now[2] / 1000000)
+
+local tat = redis.call("GET", rate_limit_key)
+
+if not tat then
+  tat = now
+else
+  tat = tonumber(tat)
+end
+
+tat = math.max(tat, now)
+
+local new_tat = tat + increment
+local allow_at = new_tat - burst_offset
+
+local diff = now - allow_at
+local remaining = diff / emission_interval
+
+-- the events are booked even if they are allowed in the future, unless they have to
+-- wait more than max_wait. a negative max_wait means no limit.
+if remaining < 0 and max_wait >= 0 and -diff > max_wait then
+  local reset_after = tat - now
+  return {
+    0, -- allowed
+    0, -- remaining
+    tostring(-diff),
+    tostring(reset_after),
+  }
+end
+
+local reset_after = new_tat - now
+redis.call("SET", rate_limit_key, new_tat, "EX", math.ceil(reset_after))
+
+if remaining < 0 then
+  return {cost, 0, tostring(-diff), tostring(reset_after)}
+end
+
+return {cost, remaining, tostring(-1), tostring(reset_after)}
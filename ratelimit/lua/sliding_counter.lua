@@ -0,0 +1,76 @@
+-- this script has side-effects, so it requires replicate commands mode
+redis.replicate_commands()
+
+local key = KEYS[1]
+local rate = tonumber(ARGV[1])
+local period = tonumber(ARGV[2]) -- milliseconds
+local cost = tonumber(ARGV[3])
+local at_most = ARGV[4] == "1"
+local inspect = ARGV[5] == "1"
+
+local now = redis.call("TIME")
+now = now[1] * 1000 + math.floor(now[2] / 1000)
+
+-- the key keeps the counts of the current and the previous fixed windows. the count
+-- of the sliding window is estimated by weighting the previous count by the part of
+-- the sliding window which overlaps the previous window.
+local window = math.floor(now / period)
+local elapsed = now - window * period
+local left = period - elapsed
+
+local state = redis.call("HMGET", key, "w", "c", "p")
+local w = tonumber(state[1])
+local cur = 0
+local prev = 0
+if w == window then
+  cur = tonumber(state[2])
+  prev = tonumber(state[3])
+elseif w == window - 1 then
+  prev = tonumber(state[2])
+end
+
+local reset_after = 0
+if cur > 0 then
+  reset_after = left + period
+elseif prev > 0 then
+  reset_after = left
+end
+
+local estimated = prev * left / period + cur
+local remaining = math.floor(rate - estimated)
+local needed = cost
+if at_most or inspect then
+  cost = math.min(cost, remaining)
+  needed = 1
+end
+
+-- inspect only reports the state of the key.
+if inspect and remaining > 0 then
+  return {0, remaining, tostring(-1), tostring(reset_after / 1000)}
+end
+
+if remaining <= 0 or cost > remaining then
+  local target = rate - needed
+  local retry_after
+  if target < 0 then
+    retry_after = left + period
+  elseif target >= cur and prev > 0 then
+    -- the previous window weighs less as time passes.
+    retry_after = left - (target - cur) * period / prev
+  else
+    -- only the current window counts once the next window starts.
+    retry_after = left + period - target * period / cur
+  end
+
+  return {
+    0, -- allowed
+    0, -- remaining
+    tostring(retry_after / 1000),
+    tostring(reset_after / 1000),
+  }
+end
+
+redis.call("HSET", key, "w", window, "c", cur + cost, "p", prev)
+redis.call("PEXPIRE", key, left + period)
+
+return {cost, remaining - cost, tostring(-1), tostring((left + period) / 1000)}
@@ -0,0 +1,60 @@
+-- this script has side-effects, so it requires replicate commands mode
+redis.replicate_commands()
+
+local key = KEYS[1]
+local rate = tonumber(ARGV[1])
+local period = tonumber(ARGV[2]) -- milliseconds
+local cost = tonumber(ARGV[3])
+local at_most = ARGV[4] == "1"
+local inspect = ARGV[5] == "1"
+
+local now = redis.call("TIME")
+now = now[1] * 1000 + math.floor(now[2] / 1000)
+
+-- the key is a sorted set of the events scored by their time, an event is in the
+-- window until period has passed since it happened.
+redis.call("ZREMRANGEBYSCORE", key, "-inf", now - period)
+local count = redis.call("ZCARD", key)
+
+local reset_after = 0
+if count > 0 then
+  local newest = redis.call("ZRANGE", key, -1, -1, "WITHSCORES")
+  reset_after = tonumber(newest[2]) + period - now
+end
+
+local remaining = rate - count
+local needed = cost
+if at_most or inspect then
+  cost = math.min(cost, remaining)
+  needed = 1
+end
+
+-- inspect only reports the state of the key.
+if inspect and remaining > 0 then
+  return {0, remaining, tostring(-1), tostring(reset_after / 1000)}
+end
+
+if remaining <= 0 or cost > remaining then
+  local retry_after = period
+  if count > 0 then
+    -- the events are allowed when enough of the oldest events leave the window.
+    local idx = math.max(math.min(count + needed - rate, count) - 1, 0)
+    local oldest = redis.call("ZRANGE", key, idx, idx, "WITHSCORES")
+    retry_after = tonumber(oldest[2]) + period - now
+  end
+  return {
+    0, -- allowed
+    0, -- remaining
+    tostring(retry_after / 1000),
+    tostring(reset_after / 1000),
+  }
+end
+
+-- the members must be unique, the count makes them unique even if several events
+-- happen in the same millisecond.
+for i = 1, cost do
+  redis.call("ZADD", key, now, now .. ":" .. (count + i))
+end
+redis.call("PEXPIRE", key, period)
+
+return {cost, remaining - cost, tostring(-1), tostring(period / 1000)}
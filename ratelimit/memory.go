@@ -0,0 +1,389 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// jan2017 is the epoch used by the Lua scripts, the memory backend uses the same
+// epoch to get identical floating point results.
+const jan2017 = 1483228800
+
+// memorySweepEvery is the number of writes after which the expired keys are removed.
+const memorySweepEvery = 1024
+
+type memoryEntry struct {
+	// tat is the theoretical arrival time of GCRA.
+	tat float64
+	// window, count and prev are the current window and the counts of the current
+	// and the previous windows of the window algorithms.
+	window int64
+	count  int
+	prev   int
+	// log is the time of the events of the sliding window log, in unix milliseconds.
+	log []int64
+
+	expireAt time.Time
+}
+
+type memoryBackend struct {
+	mtx    sync.Mutex
+	now    func() time.Time
+	keys   map[string]memoryEntry
+	writes int
+}
+
+var _ Backend = (*memoryBackend)(nil)
+
+// NewMemoryBackend returns a Backend which runs the GCRA algorithm in the process
+// memory. It is useful for tests and single instance tools, the limits are not
+// shared between processes.
+func NewMemoryBackend() Backend {
+	return newMemoryBackend(time.Now)
+}
+
+func newMemoryBackend(now func() time.Time) *memoryBackend {
+	return &memoryBackend{
+		now:  now,
+		keys: make(map[string]memoryEntry),
+	}
+}
+
+// AllowN is the Go port of lua/allow_n.lua.
+func (b *memoryBackend) AllowN(_ context.Context, key string, limit Limit, n int) (*Result, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if limit.Algorithm != GCRA {
+		return b.allowWindow(key, limit, n, windowAllowN)
+	}
+
+	t, now := b.clock()
+	emissionInterval := limit.Period.Seconds() / float64(limit.Rate)
+	increment := emissionInterval * float64(n)
+	burstOffset := emissionInterval * float64(limit.Burst)
+
+	tat := math.Max(b.tat(key, t, now), now)
+	newTat := tat + increment
+	allowAt := newTat - burstOffset
+	diff := now - allowAt
+	remaining := diff / emissionInterval
+
+	if remaining < 0 {
+		return &Result{
+			Limit:      limit,
+			Allowed:    0,
+			Remaining:  0,
+			RetryAfter: dur(-diff),
+			ResetAfter: dur(tat - now),
+		}, nil
+	}
+
+	resetAfter := newTat - now
+	if resetAfter > 0 {
+		b.set(key, newTat, t, resetAfter)
+	}
+
+	return &Result{
+		Limit:      limit,
+		Allowed:    n,
+		Remaining:  int(remaining),
+		RetryAfter: -1,
+		ResetAfter: dur(resetAfter),
+	}, nil
+}
+
+// AllowAtMost is the Go port of lua/allow_atmost_n.lua.
+func (b *memoryBackend) AllowAtMost(_ context.Context, key string, limit Limit, n int) (*Result, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if limit.Algorithm != GCRA {
+		return b.allowWindow(key, limit, n, windowAllowAtMost)
+	}
+
+	t, now := b.clock()
+	emissionInterval := limit.Period.Seconds() / float64(limit.Rate)
+	burstOffset := emissionInterval * float64(limit.Burst)
+
+	tat := math.Max(b.tat(key, t, now), now)
+	diff := now - (tat - burstOffset)
+	remaining := diff / emissionInterval
+
+	if remaining < 1 {
+		return &Result{
+			Limit:      limit,
+			Allowed:    0,
+			Remaining:  0,
+			RetryAfter: dur(emissionInterval - diff),
+			ResetAfter: dur(tat - now),
+		}, nil
+	}
+
+	cost := float64(n)
+	if remaining < cost {
+		cost = remaining
+		remaining = 0
+	} else {
+		remaining -= cost
+	}
+
+	newTat := tat + emissionInterval*cost
+	resetAfter := newTat - now
+	if resetAfter > 0 {
+		b.set(key, newTat, t, resetAfter)
+	}
+
+	return &Result{
+		Limit:      limit,
+		Allowed:    int(cost),
+		Remaining:  int(remaining),
+		RetryAfter: -1,
+		ResetAfter: dur(resetAfter),
+	}, nil
+}
+
+// Reserve is the Go port of lua/reserve_n.lua.
+func (b *memoryBackend) Reserve(
+	_ context.Context,
+	key string,
+	limit Limit,
+	n int,
+	maxWait time.Duration,
+) (*Result, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	t, now := b.clock()
+	emissionInterval := limit.Period.Seconds() / float64(limit.Rate)
+	increment := emissionInterval * float64(n)
+	burstOffset := emissionInterval * float64(limit.Burst)
+
+	tat := math.Max(b.tat(key, t, now), now)
+	newTat := tat + increment
+	allowAt := newTat - burstOffset
+	diff := now - allowAt
+	remaining := diff / emissionInterval
+
+	if remaining < 0 && maxWait >= 0 && -diff > maxWait.Seconds() {
+		return &Result{
+			Limit:      limit,
+			Allowed:    0,
+			Remaining:  0,
+			RetryAfter: dur(-diff),
+			ResetAfter: dur(tat - now),
+		}, nil
+	}
+
+	resetAfter := newTat - now
+	b.set(key, newTat, t, resetAfter)
+
+	res := &Result{
+		Limit:      limit,
+		Allowed:    n,
+		Remaining:  int(remaining),
+		RetryAfter: -1,
+		ResetAfter: dur(resetAfter),
+	}
+	if remaining < 0 {
+		res.Remaining = 0
+		res.RetryAfter = dur(-diff)
+	}
+
+	return res, nil
+}
+
+// Cancel is the Go port of lua/cancel_n.lua.
+func (b *memoryBackend) Cancel(_ context.Context, key string, limit Limit, n int) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	t, now := b.clock()
+	e, ok := b.keys[key]
+	if !ok || !t.Before(e.expireAt) {
+		return nil
+	}
+
+	newTat := e.tat - limit.Period.Seconds()/float64(limit.Rate)*float64(n)
+	resetAfter := newTat - now
+	if resetAfter > 0 {
+		b.set(key, newTat, t, resetAfter)
+	} else {
+		delete(b.keys, key)
+	}
+
+	return nil
+}
+
+// AllowMulti is the Go port of lua/allow_multi.lua.
+func (b *memoryBackend) AllowMulti(
+	_ context.Context,
+	key string,
+	limits []Limit,
+	n int,
+) (*MultiResult, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	type window struct {
+		key       string
+		tat       float64
+		newTat    float64
+		diff      float64
+		remaining float64
+		available float64
+	}
+
+	t, now := b.clock()
+	windows := make([]window, len(limits))
+	allowed := true
+	for i, limit := range limits {
+		emissionInterval := limit.Period.Seconds() / float64(limit.Rate)
+		burstOffset := emissionInterval * float64(limit.Burst)
+
+		w := window{key: windowKey(key, limit)}
+		w.tat = math.Max(b.tat(w.key, t, now), now)
+		w.newTat = w.tat + emissionInterval*float64(n)
+		w.diff = now - (w.newTat - burstOffset)
+		w.remaining = w.diff / emissionInterval
+		w.available = (now - (w.tat - burstOffset)) / emissionInterval
+		if w.remaining < 0 {
+			allowed = false
+		}
+		windows[i] = w
+	}
+
+	res := &MultiResult{
+		Results: make([]Result, len(limits)),
+		Binding: -1,
+	}
+	if allowed {
+		res.Allowed = n
+	}
+	for i, w := range windows {
+		r := Result{
+			Limit:      limits[i],
+			Allowed:    res.Allowed,
+			RetryAfter: -1,
+			ResetAfter: dur(w.tat - now),
+		}
+		switch {
+		case allowed:
+			resetAfter := w.newTat - now
+			if resetAfter > 0 {
+				b.set(w.key, w.newTat, t, resetAfter)
+			}
+			if res.Binding < 0 || w.remaining < windows[res.Binding].remaining {
+				res.Binding = i
+			}
+			r.Remaining = int(w.remaining)
+			r.ResetAfter = dur(resetAfter)
+		case w.remaining < 0:
+			if res.Binding < 0 || w.diff < windows[res.Binding].diff {
+				res.Binding = i
+			}
+			r.RetryAfter = dur(-w.diff)
+		default:
+			r.Remaining = int(w.available)
+		}
+		res.Results[i] = r
+	}
+
+	return res, nil
+}
+
+// Inspect is the Go port of lua/inspect.lua.
+func (b *memoryBackend) Inspect(_ context.Context, key string, limit Limit) (*Result, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if limit.Algorithm != GCRA {
+		return b.allowWindow(key, limit, 0, windowInspect)
+	}
+
+	t, now := b.clock()
+	emissionInterval := limit.Period.Seconds() / float64(limit.Rate)
+	burstOffset := emissionInterval * float64(limit.Burst)
+
+	tat := math.Max(b.tat(key, t, now), now)
+	diff := now - (tat - burstOffset)
+	remaining := diff / emissionInterval
+
+	res := &Result{
+		Limit:      limit,
+		Allowed:    0,
+		Remaining:  int(remaining),
+		RetryAfter: -1,
+		ResetAfter: dur(tat - now),
+	}
+	if remaining < 1 {
+		res.Remaining = 0
+		res.RetryAfter = dur(emissionInterval - diff)
+	}
+
+	return res, nil
+}
+
+func (b *memoryBackend) Reset(_ context.Context, key string) error {
+	b.mtx.Lock()
+	delete(b.keys, key)
+	b.mtx.Unlock()
+
+	return nil
+}
+
+// clock returns the current time and its value in seconds since jan2017 with
+// microsecond precision, the same as the Lua scripts calculate it from Redis TIME.
+func (b *memoryBackend) clock() (time.Time, float64) {
+	t := b.now()
+
+	return t, float64(t.Unix()-jan2017) + float64(t.Nanosecond()/1000)/1000000
+}
+
+// entry returns the entry of the key if it is not expired.
+func (b *memoryBackend) entry(key string, t time.Time) (memoryEntry, bool) {
+	e, ok := b.keys[key]
+	if !ok || !t.Before(e.expireAt) {
+		return memoryEntry{}, false
+	}
+
+	return e, true
+}
+
+// tat returns the stored theoretical arrival time of the key, or now if the key does
+// not exist.
+func (b *memoryBackend) tat(key string, t time.Time, now float64) float64 {
+	e, ok := b.entry(key, t)
+	if !ok {
+		return now
+	}
+
+	return e.tat
+}
+
+// set stores the tat of the key, the key expires like a Redis key set with
+// EX math.ceil(ttl).
+func (b *memoryBackend) set(key string, tat float64, t time.Time, ttl float64) {
+	b.put(key, memoryEntry{
+		tat:      tat,
+		expireAt: t.Add(time.Duration(math.Ceil(ttl)) * time.Second),
+	}, t)
+}
+
+// put stores the entry of the key and removes the expired keys once in a while.
+func (b *memoryBackend) put(key string, e memoryEntry, t time.Time) {
+	b.keys[key] = e
+
+	b.writes++
+	if b.writes < memorySweepEvery {
+		return
+	}
+	b.writes = 0
+	for k, e := range b.keys {
+		if !t.Before(e.expireAt) {
+			delete(b.keys, k)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package ratelimit
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// allowWindow evaluates the window algorithms. The caller must hold the lock.
+func (b *memoryBackend) allowWindow(key string, limit Limit, n int, mode windowMode) (*Result, error) {
+	switch limit.Algorithm {
+	case FixedWindow:
+		return b.fixedWindow(key, limit, n, mode), nil
+	case SlidingWindowLog:
+		return b.slidingLog(key, limit, n, mode), nil
+	case SlidingWindowCounter:
+		return b.slidingCounter(key, limit, n, mode), nil
+	}
+
+	return nil, ErrUnsupportedAlgorithm
+}
+
+// windowResult returns the result of the window algorithms, the durations are in
+// milliseconds as the Lua scripts calculate them.
+func windowResult(limit Limit, allowed, remaining int, retryAfter, resetAfter float64) *Result {
+	res := &Result{
+		Limit:      limit,
+		Allowed:    allowed,
+		Remaining:  remaining,
+		RetryAfter: -1,
+		ResetAfter: msDur(resetAfter),
+	}
+	if retryAfter >= 0 {
+		res.RetryAfter = msDur(retryAfter)
+	}
+
+	return res
+}
+
+// msDur converts milliseconds to a duration the same way the Lua results are
+// parsed, i.e. through their string representation in seconds.
+func msDur(ms float64) time.Duration {
+	f, _ := strconv.ParseFloat(strconv.FormatFloat(ms/1000, 'g', 14, 64), 64)
+
+	return dur(f)
+}
+
+// fixedWindow is the Go port of lua/fixed_window.lua.
+func (b *memoryBackend) fixedWindow(key string, limit Limit, n int, mode windowMode) *Result {
+	t := b.now()
+	now := t.UnixMilli()
+	period := limit.Period.Milliseconds()
+
+	window := now / period
+	windowEnd := (window + 1) * period
+
+	count := 0
+	if e, ok := b.entry(key, t); ok && e.window == window {
+		count = e.count
+	}
+
+	resetAfter := float64(windowEnd - now)
+	if count == 0 {
+		resetAfter = 0
+	}
+
+	remaining := limit.Rate - count
+	cost := n
+	if mode == windowAllowAtMost {
+		cost = min(cost, remaining)
+	}
+
+	if mode == windowInspect && remaining > 0 {
+		return windowResult(limit, 0, remaining, -1, resetAfter)
+	}
+
+	if remaining <= 0 || cost > remaining {
+		return windowResult(limit, 0, 0, float64(windowEnd-now), resetAfter)
+	}
+
+	b.put(key, memoryEntry{
+		window:   window,
+		count:    count + cost,
+		expireAt: time.UnixMilli(windowEnd),
+	}, t)
+
+	return windowResult(limit, cost, remaining-cost, -1, float64(windowEnd-now))
+}
+
+// slidingLog is the Go port of lua/sliding_log.lua.
+func (b *memoryBackend) slidingLog(key string, limit Limit, n int, mode windowMode) *Result {
+	t := b.now()
+	now := t.UnixMilli()
+	period := limit.Period.Milliseconds()
+
+	e, _ := b.entry(key, t)
+	log := e.log
+	for len(log) > 0 && log[0] <= now-period {
+		log = log[1:]
+	}
+	count := len(log)
+	if count > 0 {
+		e.log = log
+		b.keys[key] = e
+	} else {
+		delete(b.keys, key)
+	}
+
+	resetAfter := 0.0
+	if count > 0 {
+		resetAfter = float64(log[count-1] + period - now)
+	}
+
+	remaining := limit.Rate - count
+	cost, needed := n, n
+	if mode != windowAllowN {
+		cost = min(cost, remaining)
+		needed = 1
+	}
+
+	if mode == windowInspect && remaining > 0 {
+		return windowResult(limit, 0, remaining, -1, resetAfter)
+	}
+
+	if remaining <= 0 || cost > remaining {
+		retryAfter := float64(period)
+		if count > 0 {
+			idx := max(min(count+needed-limit.Rate, count)-1, 0)
+			retryAfter = float64(log[idx] + period - now)
+		}
+
+		return windowResult(limit, 0, 0, retryAfter, resetAfter)
+	}
+
+	log = append(log[:count:count], make([]int64, cost)...)
+	for i := count; i < len(log); i++ {
+		log[i] = now
+	}
+	b.put(key, memoryEntry{log: log, expireAt: t.Add(limit.Period)}, t)
+
+	return windowResult(limit, cost, remaining-cost, -1, float64(period))
+}
+
+// slidingCounter is the Go port of lua/sliding_counter.lua.
+func (b *memoryBackend) slidingCounter(key string, limit Limit, n int, mode windowMode) *Result {
+	t := b.now()
+	now := t.UnixMilli()
+	period := limit.Period.Milliseconds()
+
+	window := now / period
+	left := float64(period - (now - window*period))
+
+	cur, prev := 0, 0
+	if e, ok := b.entry(key, t); ok {
+		switch e.window {
+		case window:
+			cur, prev = e.count, e.prev
+		case window - 1:
+			prev = e.count
+		}
+	}
+
+	p := float64(period)
+	resetAfter := 0.0
+	if cur > 0 {
+		resetAfter = left + p
+	} else if prev > 0 {
+		resetAfter = left
+	}
+
+	estimated := float64(prev)*left/p + float64(cur)
+	remaining := int(math.Floor(float64(limit.Rate) - estimated))
+	cost, needed := n, n
+	if mode != windowAllowN {
+		cost = min(cost, remaining)
+		needed = 1
+	}
+
+	if mode == windowInspect && remaining > 0 {
+		return windowResult(limit, 0, remaining, -1, resetAfter)
+	}
+
+	if remaining <= 0 || cost > remaining {
+		target := float64(limit.Rate - needed)
+		var retryAfter float64
+		switch {
+		case target < 0:
+			retryAfter = left + p
+		case target >= float64(cur) && prev > 0:
+			retryAfter = left - (target-float64(cur))*p/float64(prev)
+		default:
+			retryAfter = left + p - target*p/float64(cur)
+		}
+
+		return windowResult(limit, 0, 0, retryAfter, resetAfter)
+	}
+
+	b.put(key, memoryEntry{
+		window:   window,
+		count:    cur + cost,
+		prev:     prev,
+		expireAt: t.Add(time.Duration(left+p) * time.Millisecond),
+	}, t)
+
+	return windowResult(limit, cost, remaining-cost, -1, left+p)
+}
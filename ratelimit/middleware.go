@@ -0,0 +1,259 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clubpay/qlubkit-go/telemetry/log"
+)
+
+// KeyFunc extracts the rate limit key of a request. If it returns an empty key, the
+// request is not rate limited.
+type KeyFunc func(r *http.Request) string
+
+// ClientIP uses the client IP as the key. The X-Forwarded-For header is only trusted
+// if the request comes from one of the trusted proxies, which are IPs or CIDRs.
+// Invalid proxies are ignored.
+func ClientIP(trustedProxies ...string) KeyFunc {
+	var trusted []netip.Prefix
+	for _, p := range trustedProxies {
+		if prefix, err := netip.ParsePrefix(p); err == nil {
+			trusted = append(trusted, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(p); err == nil {
+			trusted = append(trusted, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		}
+	}
+	isTrusted := func(addr netip.Addr) bool {
+		for _, p := range trusted {
+			if p.Contains(addr) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return func(r *http.Request) string {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			return host
+		}
+		addr = addr.Unmap()
+		if !isTrusted(addr) {
+			return addr.String()
+		}
+
+		// Walk the forwarded chain from the nearest hop, the first untrusted hop is the client.
+		hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+			addr = hop.Unmap()
+			if !isTrusted(addr) {
+				break
+			}
+		}
+
+		return addr.String()
+	}
+}
+
+// Header uses the value of the header as the key.
+func Header(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// User uses the authenticated user, extracted from the request context, as the key.
+func User(fn func(ctx context.Context) string) KeyFunc {
+	return func(r *http.Request) string {
+		return fn(r.Context())
+	}
+}
+
+// Route uses the route pattern matched by http.ServeMux as the key, or the path if
+// the request has not been routed by http.ServeMux.
+func Route() KeyFunc {
+	return func(r *http.Request) string {
+		if r.Pattern != "" {
+			return r.Pattern
+		}
+
+		return r.URL.Path
+	}
+}
+
+// Compose joins the keys of all the KeyFuncs, e.g. Compose(Route(), ClientIP()) limits
+// each client on each route. If any of them returns an empty key, it returns empty key.
+func Compose(fns ...KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		keys := make([]string, 0, len(fns))
+		for _, fn := range fns {
+			k := fn(r)
+			if k == "" {
+				return ""
+			}
+			keys = append(keys, k)
+		}
+
+		return strings.Join(keys, ":")
+	}
+}
+
+// Middleware is a net/http middleware which rate limits the requests and sets the
+// RateLimit-* headers of the IETF draft.
+type Middleware struct {
+	limiter *Limiter
+	limit   Limit
+	routes  map[string]Limit
+	keyFn   KeyFunc
+	prefix  string
+	dryRun  bool
+	logger  *log.Logger
+}
+
+type MiddlewareOption func(m *Middleware)
+
+// WithKeyFunc sets the KeyFunc of the middleware, default is ClientIP().
+func WithKeyFunc(fn KeyFunc) MiddlewareOption {
+	return func(m *Middleware) {
+		m.keyFn = fn
+	}
+}
+
+// WithRouteLimit overrides the limit for the requests matching the route pattern of
+// http.ServeMux, e.g. "POST /payments/{id}". Each route has its own quota. The middleware
+// must wrap the handlers registered on the mux for the route pattern to be known.
+func WithRouteLimit(pattern string, limit Limit) MiddlewareOption {
+	return func(m *Middleware) {
+		m.routes[pattern] = limit
+	}
+}
+
+// WithKeyPrefix prefixes all the keys, default is "ratelimit:".
+func WithKeyPrefix(prefix string) MiddlewareOption {
+	return func(m *Middleware) {
+		m.prefix = prefix
+	}
+}
+
+// WithDryRun only logs the requests which would be rejected and lets them through.
+func WithDryRun() MiddlewareOption {
+	return func(m *Middleware) {
+		m.dryRun = true
+	}
+}
+
+// WithLogger sets the logger of the middleware, default is log.DefaultLogger.
+func WithLogger(l *log.Logger) MiddlewareOption {
+	return func(m *Middleware) {
+		m.logger = l
+	}
+}
+
+// NewMiddleware creates a middleware which applies limit to the requests, unless a
+// route limit is set for the request's route.
+func NewMiddleware(limiter *Limiter, limit Limit, opts ...MiddlewareOption) *Middleware {
+	m := &Middleware{
+		limiter: limiter,
+		limit:   limit,
+		routes:  make(map[string]Limit),
+		keyFn:   ClientIP(),
+		prefix:  "ratelimit:",
+		logger:  log.DefaultLogger,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := m.keyFn(r)
+		if key == "" {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		limit := m.limit
+		key = m.prefix + key
+		if routeLimit, ok := m.routes[r.Pattern]; ok && r.Pattern != "" {
+			limit = routeLimit
+			key = key + ":" + r.Pattern
+		}
+		if limit.IsZero() {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		res, err := m.limiter.Allow(r.Context(), key, limit)
+		if err != nil {
+			// Do not reject the requests if the backend is not available.
+			m.logger.WarnCtx(r.Context(), "rate limiter failed", log.String("key", key), log.Error(err))
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		if m.dryRun {
+			if res.Allowed == 0 {
+				m.logger.InfoCtx(
+					r.Context(), "rate limit exceeded (dry run)",
+					log.String("key", key),
+					log.String("limit", limit.String()),
+					log.Duration("retryAfter", res.RetryAfter),
+				)
+			}
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		setHeaders(w.Header(), res)
+		if res.Allowed == 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func setHeaders(hdr http.Header, res *Result) {
+	hdr.Set("RateLimit-Limit", strconv.Itoa(res.Limit.capacity()))
+	hdr.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	hdr.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+
+	policy := strconv.Itoa(res.Limit.Rate) + ";w=" + strconv.Itoa(ceilSeconds(res.Limit.Period))
+	if res.Limit.Algorithm == GCRA {
+		policy += ";burst=" + strconv.Itoa(res.Limit.Burst)
+	}
+	hdr.Set("RateLimit-Policy", policy)
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+
+	return int(math.Ceil(d.Seconds()))
+}
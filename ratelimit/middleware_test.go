@@ -0,0 +1,118 @@
+package ratelimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/clubpay/qlubkit-go/ratelimit"
+	"github.com/clubpay/qlubkit-go/telemetry/log"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	do := func(h http.Handler, method, path, remoteAddr string, hdr map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remoteAddr
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	Convey("Middleware", t, func(c C) {
+		l := ratelimit.NewLimiterWithBackend(ratelimit.NewMemoryBackend())
+
+		Convey("Rejects with standard headers", func(c C) {
+			h := ratelimit.NewMiddleware(l, ratelimit.PerMinute(2)).Handler(ok)
+
+			rec := do(h, http.MethodGet, "/", "10.0.0.1:1234", nil)
+			c.So(rec.Code, ShouldEqual, http.StatusOK)
+			c.So(rec.Header().Get("RateLimit-Limit"), ShouldEqual, "2")
+			c.So(rec.Header().Get("RateLimit-Remaining"), ShouldEqual, "1")
+			c.So(rec.Header().Get("RateLimit-Reset"), ShouldEqual, "30")
+			c.So(rec.Header().Get("RateLimit-Policy"), ShouldEqual, "2;w=60;burst=2")
+
+			_ = do(h, http.MethodGet, "/", "10.0.0.1:1234", nil)
+			rec = do(h, http.MethodGet, "/", "10.0.0.1:1234", nil)
+			c.So(rec.Code, ShouldEqual, http.StatusTooManyRequests)
+			c.So(rec.Header().Get("RateLimit-Remaining"), ShouldEqual, "0")
+			c.So(rec.Header().Get("Retry-After"), ShouldEqual, "30")
+
+			rec = do(h, http.MethodGet, "/", "10.0.0.2:1234", nil)
+			c.So(rec.Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("Dry run", func(c C) {
+			h := ratelimit.NewMiddleware(
+				l, ratelimit.PerMinute(1),
+				ratelimit.WithDryRun(),
+				ratelimit.WithLogger(log.NopLogger),
+			).Handler(ok)
+			for i := 0; i < 3; i++ {
+				rec := do(h, http.MethodGet, "/", "10.0.0.1:1234", nil)
+				c.So(rec.Code, ShouldEqual, http.StatusOK)
+				c.So(rec.Header().Get("RateLimit-Limit"), ShouldBeEmpty)
+			}
+		})
+
+		Convey("Header key", func(c C) {
+			h := ratelimit.NewMiddleware(
+				l, ratelimit.PerMinute(1),
+				ratelimit.WithKeyFunc(ratelimit.Header("X-Api-Key")),
+			).Handler(ok)
+			c.So(do(h, http.MethodGet, "/", "10.0.0.1:1", map[string]string{"X-Api-Key": "a"}).Code, ShouldEqual, http.StatusOK)
+			c.So(do(h, http.MethodGet, "/", "10.0.0.2:1", map[string]string{"X-Api-Key": "a"}).Code, ShouldEqual, http.StatusTooManyRequests)
+			c.So(do(h, http.MethodGet, "/", "10.0.0.2:1", map[string]string{"X-Api-Key": "b"}).Code, ShouldEqual, http.StatusOK)
+			// Requests without key are not limited.
+			c.So(do(h, http.MethodGet, "/", "10.0.0.2:1", nil).Code, ShouldEqual, http.StatusOK)
+			c.So(do(h, http.MethodGet, "/", "10.0.0.2:1", nil).Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("Route limits", func(c C) {
+			m := ratelimit.NewMiddleware(
+				l, ratelimit.PerMinute(10),
+				ratelimit.WithRouteLimit("POST /pay/{id}", ratelimit.PerMinute(1)),
+			)
+			mux := http.NewServeMux()
+			mux.Handle("POST /pay/{id}", m.Handler(ok))
+			mux.Handle("GET /bill/{id}", m.Handler(ok))
+
+			c.So(do(mux, http.MethodPost, "/pay/1", "10.0.0.1:1", nil).Code, ShouldEqual, http.StatusOK)
+			c.So(do(mux, http.MethodPost, "/pay/2", "10.0.0.1:1", nil).Code, ShouldEqual, http.StatusTooManyRequests)
+			rec := do(mux, http.MethodGet, "/bill/1", "10.0.0.1:1", nil)
+			c.So(rec.Code, ShouldEqual, http.StatusOK)
+			c.So(rec.Header().Get("RateLimit-Limit"), ShouldEqual, "10")
+		})
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	Convey("ClientIP", t, func(c C) {
+		keyFn := ratelimit.ClientIP("10.0.0.0/8", "192.168.1.1")
+		key := func(remoteAddr, xff string) string {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = remoteAddr
+			if xff != "" {
+				req.Header.Set("X-Forwarded-For", xff)
+			}
+
+			return keyFn(req)
+		}
+
+		c.So(key("1.2.3.4:80", ""), ShouldEqual, "1.2.3.4")
+		// Untrusted peers cannot spoof the header.
+		c.So(key("1.2.3.4:80", "5.6.7.8"), ShouldEqual, "1.2.3.4")
+		c.So(key("10.1.1.1:80", "5.6.7.8"), ShouldEqual, "5.6.7.8")
+		c.So(key("10.1.1.1:80", "9.9.9.9, 5.6.7.8, 192.168.1.1"), ShouldEqual, "5.6.7.8")
+		c.So(key("10.1.1.1:80", "10.2.2.2"), ShouldEqual, "10.2.2.2")
+		c.So(key("[::ffff:1.2.3.4]:80", ""), ShouldEqual, "1.2.3.4")
+	})
+}
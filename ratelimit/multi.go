@@ -0,0 +1,194 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrNoLimits = errors.New("ratelimit: no limits")
+
+// MultiResult is the result of evaluating several limits for one key.
+type MultiResult struct {
+	// Allowed is n if all the limits allowed the events, otherwise it is 0 and none
+	// of the limits is consumed.
+	Allowed int
+
+	// Results has the result of each limit, in the order of the limits.
+	Results []Result
+
+	// Binding is the index of the limit which is the binding constraint. If the
+	// events are denied, it is the limit with the longest RetryAfter, otherwise it
+	// is the limit with the least Remaining.
+	Binding int
+}
+
+// Result returns the result of the binding limit.
+func (r *MultiResult) Result() *Result {
+	res := r.Results[r.Binding]
+	res.Allowed = r.Allowed
+
+	return &res
+}
+
+// windowKey returns the key which keeps the state of the limit when several limits
+// are evaluated for key. All the window keys of a key are in the same Redis Cluster
+// slot.
+func windowKey(key string, limit Limit) string {
+	return slotKey(key, fmt.Sprintf("%d/%d/%s", limit.Rate, limit.Burst, limit.Period))
+}
+
+// AllowMulti reports whether n events may happen at time now under all the limits,
+// e.g. 10/s and 500/m and 10k/day. The events are allowed by all the limits or
+// none of them. Only GCRA limits are supported.
+func (l Limiter) AllowMulti(
+	ctx context.Context,
+	key string,
+	limits []Limit,
+	n int,
+) (*MultiResult, error) {
+	if len(limits) == 0 {
+		return nil, ErrNoLimits
+	}
+	for _, limit := range limits {
+		if limit.Algorithm != GCRA {
+			return nil, ErrUnsupportedAlgorithm
+		}
+	}
+
+	start := time.Now()
+	res, err := l.backend.AllowMulti(ctx, key, limits, n)
+	if err != nil {
+		res, err = l.failedMulti(ctx, key, limits, n, err)
+		if err != nil {
+			return nil, err
+		}
+	}
+	l.observe(ctx, key, res.Result(), time.Since(start))
+
+	return res, nil
+}
+
+// failedMulti applies the failure policy to the error of the backend.
+func (l Limiter) failedMulti(
+	ctx context.Context,
+	key string,
+	limits []Limit,
+	n int,
+	err error,
+) (*MultiResult, error) {
+	switch l.failurePolicy {
+	case FailOpen, FailClosed:
+		l.handleError(ctx, key, err)
+
+		res := &MultiResult{
+			Results: make([]Result, len(limits)),
+		}
+		for i, limit := range limits {
+			res.Results[i] = *l.policyResult(limit, n)
+		}
+		res.Allowed = res.Results[0].Allowed
+
+		return res, nil
+	case FallbackLocal:
+		l.handleError(ctx, key, err)
+
+		return l.fallback.AllowMulti(ctx, key, limits, n)
+	}
+
+	return nil, err
+}
+
+// ResetMulti removes the state of the key for all the limits used with AllowMulti.
+func (l Limiter) ResetMulti(ctx context.Context, key string, limits []Limit) error {
+	for _, limit := range limits {
+		if err := l.backend.Reset(ctx, windowKey(key, limit)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+const (
+	TierFree     = "free"
+	TierStandard = "standard"
+	TierPremium  = "premium"
+)
+
+var ErrUnknownTier = errors.New("ratelimit: unknown tier")
+
+// Tier is a named set of limits which are evaluated together.
+type Tier struct {
+	Name   string
+	Limits []Limit
+}
+
+// TierResolver returns the name of the tier of the key.
+type TierResolver func(ctx context.Context, key string) (string, error)
+
+// StaticTiers resolves the tiers from a map of keys to tier names. The keys which
+// are not in the map are resolved to an empty name, i.e. the default tier.
+func StaticTiers(m map[string]string) TierResolver {
+	return func(_ context.Context, key string) (string, error) {
+		return m[key], nil
+	}
+}
+
+// TierSet resolves the tier of the keys.
+type TierSet struct {
+	tiers    map[string]Tier
+	def      string
+	resolver TierResolver
+}
+
+// NewTierSet returns a TierSet which uses the resolver to find the tier of a key.
+// If the resolver returns an empty name, the tier named def is used.
+func NewTierSet(resolver TierResolver, def string, tiers ...Tier) *TierSet {
+	ts := &TierSet{
+		tiers:    make(map[string]Tier, len(tiers)),
+		def:      def,
+		resolver: resolver,
+	}
+	for _, t := range tiers {
+		ts.tiers[t.Name] = t
+	}
+
+	return ts
+}
+
+// Resolve returns the tier of the key.
+func (ts *TierSet) Resolve(ctx context.Context, key string) (Tier, error) {
+	name, err := ts.resolver(ctx, key)
+	if err != nil {
+		return Tier{}, err
+	}
+	if name == "" {
+		name = ts.def
+	}
+
+	t, ok := ts.tiers[name]
+	if !ok {
+		return Tier{}, fmt.Errorf("%w: %q", ErrUnknownTier, name)
+	}
+
+	return t, nil
+}
+
+// AllowTier is like AllowMulti with the limits of the tier of the key.
+func (l Limiter) AllowTier(
+	ctx context.Context,
+	ts *TierSet,
+	key string,
+	n int,
+) (*MultiResult, error) {
+	t, err := ts.Resolve(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.AllowMulti(ctx, key, t.Limits, n)
+}
@@ -0,0 +1,118 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/clubpay/qlubkit-go/ratelimit"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAllowMulti(t *testing.T) {
+	Convey("AllowMulti", t, func(c C) {
+		ctx := context.Background()
+		for name, b := range backends(t) {
+			Convey(name, func(c C) {
+				l := ratelimit.NewLimiterWithBackend(b)
+
+				Convey("The window with the least remaining is binding", func(c C) {
+					limits := []ratelimit.Limit{ratelimit.PerSecond(2), ratelimit.PerMinute(3)}
+
+					res, err := l.AllowMulti(ctx, "k", limits, 1)
+					c.So(err, ShouldBeNil)
+					c.So(res.Allowed, ShouldEqual, 1)
+					c.So(res.Binding, ShouldEqual, 0)
+					c.So(res.Results[0].Remaining, ShouldEqual, 1)
+					c.So(res.Results[0].ResetAfter.Seconds(), ShouldAlmostEqual, 0.5, tolerance)
+					c.So(res.Results[1].Remaining, ShouldEqual, 2)
+					c.So(res.Results[1].ResetAfter.Seconds(), ShouldAlmostEqual, 20, tolerance)
+
+					_, err = l.AllowMulti(ctx, "k", limits, 1)
+					c.So(err, ShouldBeNil)
+
+					res, err = l.AllowMulti(ctx, "k", limits, 1)
+					c.So(err, ShouldBeNil)
+					c.So(res.Allowed, ShouldEqual, 0)
+					c.So(res.Binding, ShouldEqual, 0)
+					c.So(res.Results[0].RetryAfter.Seconds(), ShouldAlmostEqual, 0.5, tolerance)
+					c.So(res.Results[1].Remaining, ShouldEqual, 1)
+					c.So(res.Results[1].RetryAfter, ShouldEqual, -1)
+
+					r := res.Result()
+					c.So(r.Limit, ShouldEqual, limits[0])
+					c.So(r.Allowed, ShouldEqual, 0)
+				})
+
+				Convey("Denied events consume none of the windows", func(c C) {
+					limits := []ratelimit.Limit{
+						{Rate: 1, Period: time.Second, Burst: 5},
+						ratelimit.PerMinute(2),
+					}
+
+					res, err := l.AllowMulti(ctx, "k", limits, 2)
+					c.So(err, ShouldBeNil)
+					c.So(res.Allowed, ShouldEqual, 2)
+					c.So(res.Binding, ShouldEqual, 1)
+
+					res, err = l.AllowMulti(ctx, "k", limits, 1)
+					c.So(err, ShouldBeNil)
+					c.So(res.Allowed, ShouldEqual, 0)
+					c.So(res.Binding, ShouldEqual, 1)
+					c.So(res.Results[1].RetryAfter.Seconds(), ShouldAlmostEqual, 30, tolerance)
+
+					res, err = l.AllowMulti(ctx, "k", limits[:1], 1)
+					c.So(err, ShouldBeNil)
+					c.So(res.Allowed, ShouldEqual, 1)
+					c.So(res.Results[0].Remaining, ShouldEqual, 2)
+
+					c.So(l.ResetMulti(ctx, "k", limits), ShouldBeNil)
+					res, err = l.AllowMulti(ctx, "k", limits, 2)
+					c.So(err, ShouldBeNil)
+					c.So(res.Allowed, ShouldEqual, 2)
+				})
+
+				Convey("No limits", func(c C) {
+					_, err := l.AllowMulti(ctx, "k", nil, 1)
+					c.So(err, ShouldEqual, ratelimit.ErrNoLimits)
+				})
+			})
+		}
+	})
+}
+
+func TestAllowTier(t *testing.T) {
+	Convey("AllowTier", t, func(c C) {
+		ctx := context.Background()
+		l := ratelimit.NewLimiterWithBackend(ratelimit.NewMemoryBackend())
+		ts := ratelimit.NewTierSet(
+			ratelimit.StaticTiers(map[string]string{
+				"vip":  ratelimit.TierPremium,
+				"gold": "gold",
+			}),
+			ratelimit.TierFree,
+			ratelimit.Tier{Name: ratelimit.TierFree, Limits: []ratelimit.Limit{ratelimit.PerMinute(1)}},
+			ratelimit.Tier{Name: ratelimit.TierPremium, Limits: []ratelimit.Limit{ratelimit.PerMinute(10)}},
+		)
+
+		tier, err := ts.Resolve(ctx, "vip")
+		c.So(err, ShouldBeNil)
+		c.So(tier.Name, ShouldEqual, ratelimit.TierPremium)
+
+		res, err := l.AllowTier(ctx, ts, "someone", 1)
+		c.So(err, ShouldBeNil)
+		c.So(res.Allowed, ShouldEqual, 1)
+		res, err = l.AllowTier(ctx, ts, "someone", 1)
+		c.So(err, ShouldBeNil)
+		c.So(res.Allowed, ShouldEqual, 0)
+
+		res, err = l.AllowTier(ctx, ts, "vip", 2)
+		c.So(err, ShouldBeNil)
+		c.So(res.Allowed, ShouldEqual, 2)
+		c.So(res.Result().Remaining, ShouldEqual, 8)
+
+		_, err = l.AllowTier(ctx, ts, "gold", 1)
+		c.So(err, ShouldWrap, ratelimit.ErrUnknownTier)
+	})
+}
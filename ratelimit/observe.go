@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	qmetrics "github.com/clubpay/qlubkit-go/telemetry/metrics"
+	qtrace "github.com/clubpay/qlubkit-go/telemetry/trace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	attrKey        = "ratelimit.key"
+	attrKeyClass   = "ratelimit.key_class"
+	attrLimit      = "ratelimit.limit"
+	attrRetryAfter = "ratelimit.retry_after_ms"
+
+	eventDenied     = "ratelimit.denied"
+	defaultKeyClass = "default"
+)
+
+type limiterMetrics struct {
+	allowed  metric.Int64Counter
+	denied   metric.Int64Counter
+	latency  metric.Float64Histogram
+	keyClass func(key string) string
+}
+
+// WithMetrics records the allowed and denied decisions and the latency of the
+// backend by the meter, e.g. qmetrics.Meter("ratelimit"). keyClass maps the keys to
+// a low cardinality label such as the route or the tier, it must not return the key
+// itself. If keyClass is nil, all the keys are in the same class.
+func WithMetrics(meter metric.Meter, keyClass func(key string) string) LimiterOption {
+	return func(l *Limiter) {
+		m := &limiterMetrics{
+			keyClass: keyClass,
+		}
+		// the names are constant and valid, so creating the instruments cannot fail.
+		m.allowed, _ = meter.Int64Counter(
+			qmetrics.QlubRateLimitAllowedCnt,
+			metric.WithDescription("number of the decisions which allowed the events"),
+		)
+		m.denied, _ = meter.Int64Counter(
+			qmetrics.QlubRateLimitDeniedCnt,
+			metric.WithDescription("number of the decisions which denied the events"),
+		)
+		m.latency, _ = meter.Float64Histogram(
+			qmetrics.QlubRateLimitLatencyHist,
+			metric.WithDescription("latency of the rate limit backend"),
+			metric.WithUnit("ms"),
+		)
+		l.metrics = m
+	}
+}
+
+// observe records the decision in the metrics and adds an event to the active span
+// if the events are denied. latency is zero if the backend was not called.
+func (l Limiter) observe(ctx context.Context, key string, res *Result, latency time.Duration) {
+	if res.Allowed == 0 {
+		qtrace.Event(
+			qtrace.Span(ctx),
+			eventDenied,
+			qtrace.String(attrKey, key),
+			qtrace.String(attrLimit, res.Limit.String()),
+			qtrace.Int64(attrRetryAfter, res.RetryAfter.Milliseconds()),
+		)
+	}
+
+	m := l.metrics
+	if m == nil {
+		return
+	}
+
+	class := defaultKeyClass
+	if m.keyClass != nil {
+		class = m.keyClass(key)
+	}
+	attrs := metric.WithAttributes(attribute.String(attrKeyClass, class))
+
+	if res.Allowed > 0 {
+		m.allowed.Add(ctx, 1, attrs)
+	} else {
+		m.denied.Add(ctx, 1, attrs)
+	}
+	if latency > 0 {
+		m.latency.Record(ctx, float64(latency)/float64(time.Millisecond), attrs)
+	}
+}
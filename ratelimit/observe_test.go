@@ -0,0 +1,115 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/clubpay/qlubkit-go/ratelimit"
+	qmetrics "github.com/clubpay/qlubkit-go/telemetry/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInspect(t *testing.T) {
+	Convey("Inspect does not consume", t, func(c C) {
+		ctx := context.Background()
+		limits := map[string]ratelimit.Limit{
+			"GCRA":                 ratelimit.PerMinute(2),
+			"FixedWindow":          {Rate: 2, Period: 24 * time.Hour, Algorithm: ratelimit.FixedWindow},
+			"SlidingWindowLog":     ratelimit.PerMinute(2).WithAlgorithm(ratelimit.SlidingWindowLog),
+			"SlidingWindowCounter": {Rate: 2, Period: 24 * time.Hour, Algorithm: ratelimit.SlidingWindowCounter},
+		}
+		for name, b := range backends(t) {
+			for algorithm, limit := range limits {
+				Convey(name+"/"+algorithm, func(c C) {
+					l := ratelimit.NewLimiterWithBackend(b)
+
+					res, err := l.Inspect(ctx, "k", limit)
+					c.So(err, ShouldBeNil)
+					c.So(res.Allowed, ShouldEqual, 0)
+					c.So(res.Remaining, ShouldEqual, 2)
+					c.So(res.RetryAfter, ShouldEqual, -1)
+					c.So(res.ResetAfter.Seconds(), ShouldAlmostEqual, 0, tolerance)
+
+					allowed, err := l.Allow(ctx, "k", limit)
+					c.So(err, ShouldBeNil)
+
+					res, err = l.Inspect(ctx, "k", limit)
+					c.So(err, ShouldBeNil)
+					c.So(res.Remaining, ShouldEqual, 1)
+					c.So(res.RetryAfter, ShouldEqual, -1)
+					c.So(res.ResetAfter.Seconds(), ShouldAlmostEqual, allowed.ResetAfter.Seconds(), tolerance)
+
+					_, err = l.Allow(ctx, "k", limit)
+					c.So(err, ShouldBeNil)
+					denied, err := l.Allow(ctx, "k", limit)
+					c.So(err, ShouldBeNil)
+					c.So(denied.Allowed, ShouldEqual, 0)
+
+					res, err = l.Inspect(ctx, "k", limit)
+					c.So(err, ShouldBeNil)
+					c.So(res.Remaining, ShouldEqual, 0)
+					c.So(res.RetryAfter.Seconds(), ShouldAlmostEqual, denied.RetryAfter.Seconds(), tolerance)
+					c.So(res.ResetAfter.Seconds(), ShouldAlmostEqual, denied.ResetAfter.Seconds(), tolerance)
+				})
+			}
+		}
+	})
+}
+
+func TestObservability(t *testing.T) {
+	Convey("Metrics and traces", t, func(c C) {
+		ctx := context.Background()
+		reader := sdkmetric.NewManualReader()
+		meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("ratelimit")
+		recorder := tracetest.NewSpanRecorder()
+		tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+		l := ratelimit.NewLimiterWithBackend(
+			ratelimit.NewMemoryBackend(),
+			ratelimit.WithMetrics(meter, func(key string) string { return "user" }),
+		)
+
+		ctx, span := tracer.Start(ctx, "request")
+		for range 3 {
+			_, err := l.Allow(ctx, "user:1", ratelimit.PerMinute(2))
+			c.So(err, ShouldBeNil)
+		}
+		span.End()
+
+		var rm metricdata.ResourceMetrics
+		c.So(reader.Collect(ctx, &rm), ShouldBeNil)
+		sums := map[string]int64{}
+		var latencies uint64
+		for _, m := range rm.ScopeMetrics[0].Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					class, _ := dp.Attributes.Value("ratelimit.key_class")
+					c.So(class.AsString(), ShouldEqual, "user")
+					sums[m.Name] += dp.Value
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					latencies += dp.Count
+				}
+			}
+		}
+		c.So(sums[qmetrics.QlubRateLimitAllowedCnt], ShouldEqual, 2)
+		c.So(sums[qmetrics.QlubRateLimitDeniedCnt], ShouldEqual, 1)
+		c.So(latencies, ShouldEqual, 3)
+
+		spans := recorder.Ended()
+		c.So(spans, ShouldHaveLength, 1)
+		events := spans[0].Events()
+		c.So(events, ShouldHaveLength, 1)
+		c.So(events[0].Name, ShouldEqual, "ratelimit.denied")
+		c.So(events[0].Attributes, ShouldContain, attribute.String("ratelimit.key", "user:1"))
+	})
+}
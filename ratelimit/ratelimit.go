@@ -3,7 +3,6 @@ package ratelimit
 import (
 	"context"
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -13,9 +12,17 @@ type Limit struct {
 	Rate   int
 	Burst  int
 	Period time.Duration
+
+	// Algorithm evaluates the limit, defaults to GCRA. A key must always be used with
+	// the same algorithm.
+	Algorithm Algorithm
 }
 
 func (l Limit) String() string {
+	if l.Algorithm != GCRA {
+		return fmt.Sprintf("%d req/%s (%s)", l.Rate, fmtDur(l.Period), l.Algorithm)
+	}
+
 	return fmt.Sprintf("%d req/%s (burst %d)", l.Rate, fmtDur(l.Period), l.Burst)
 }
 
@@ -64,14 +71,33 @@ func PerHour(rate int) Limit {
 
 // Limiter controls how frequently events are allowed to happen.
 type Limiter struct {
-	rdb *redis.Client
+	backend       Backend
+	failurePolicy FailurePolicy
+	fallback      Backend
+	onError       func(ctx context.Context, key string, err error)
+	denials       *denialCache
+	metrics       *limiterMetrics
+}
+
+// NewLimiter returns a new Limiter which keeps its state in Redis. rdb can be a
+// single node, cluster or sentinel client.
+func NewLimiter(rdb redis.UniversalClient, opts ...LimiterOption) *Limiter {
+	return NewLimiterWithBackend(NewRedisBackend(rdb), opts...)
 }
 
-// NewLimiter returns a new Limiter.
-func NewLimiter(rdb *redis.Client) *Limiter {
-	return &Limiter{
-		rdb: rdb,
+// NewLimiterWithBackend returns a new Limiter which keeps its state in the backend.
+func NewLimiterWithBackend(backend Backend, opts ...LimiterOption) *Limiter {
+	l := &Limiter{
+		backend: backend,
 	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.failurePolicy == FallbackLocal && l.fallback == nil {
+		l.fallback = NewMemoryBackend()
+	}
+
+	return l
 }
 
 // Allow is a shortcut for AllowN(ctx, key, limit, 1).
@@ -86,34 +112,9 @@ func (l Limiter) AllowN(
 	limit Limit,
 	n int,
 ) (*Result, error) {
-	values := []any{limit.Burst, limit.Rate, limit.Period.Seconds(), n}
-	v, err := luaAllowN.Run(ctx, l.rdb, []string{key}, values...).Result()
-	if err != nil {
-		return nil, err
-	}
-
-	values, _ = v.([]any)
-
-	retryAfter, err := strconv.ParseFloat(values[2].(string), 64)
-	if err != nil {
-		return nil, err
-	}
-
-	resetAfter, err := strconv.ParseFloat(values[3].(string), 64)
-	if err != nil {
-		return nil, err
-	}
-
-	//nolint:forcetypeassert
-	res := &Result{
-		Limit:      limit,
-		Allowed:    int(values[0].(int64)),
-		Remaining:  int(values[1].(int64)),
-		RetryAfter: dur(retryAfter),
-		ResetAfter: dur(resetAfter),
-	}
-
-	return res, nil
+	return l.allow(ctx, key, limit, n, n, func(b Backend) (*Result, error) {
+		return b.AllowN(ctx, key, limit, n)
+	})
 }
 
 // AllowAtMost reports whether at most n events may happen at time now.
@@ -124,39 +125,64 @@ func (l Limiter) AllowAtMost(
 	limit Limit,
 	n int,
 ) (*Result, error) {
-	values := []any{limit.Burst, limit.Rate, limit.Period.Seconds(), n}
-	v, err := luaAllowAtMost.Run(ctx, l.rdb, []string{key}, values...).Result()
-	if err != nil {
-		return nil, err
-	}
+	// a denial of AllowAtMost means even one event is not allowed.
+	return l.allow(ctx, key, limit, n, 1, func(b Backend) (*Result, error) {
+		return b.AllowAtMost(ctx, key, limit, n)
+	})
+}
 
-	values, _ = v.([]any)
+// allow runs fn through the denial cache and the failure policy. needed is the
+// number of events which a denial is cached for.
+func (l Limiter) allow(
+	ctx context.Context,
+	key string,
+	limit Limit,
+	n, needed int,
+	fn func(b Backend) (*Result, error),
+) (*Result, error) {
+	if l.denials != nil {
+		if res, ok := l.denials.get(key, limit, needed); ok {
+			l.observe(ctx, key, res, 0)
 
-	retryAfter, err := strconv.ParseFloat(values[2].(string), 64)
-	if err != nil {
-		return nil, err
+			return res, nil
+		}
 	}
 
-	resetAfter, err := strconv.ParseFloat(values[3].(string), 64)
+	start := time.Now()
+	cache := l.denials != nil
+	res, err := fn(l.backend)
 	if err != nil {
-		return nil, err
+		// The results of FailOpen and FailClosed are not given by a backend, so they are
+		// not cached and the key is evaluated again once the backend is back.
+		cache = cache && l.failurePolicy == FallbackLocal
+		res, err = l.failed(ctx, key, limit, n, err, fn)
+		if err != nil {
+			return nil, err
+		}
 	}
+	l.observe(ctx, key, res, time.Since(start))
 
-	//nolint:forcetypeassert
-	res := &Result{
-		Limit:      limit,
-		Allowed:    int(values[0].(int64)),
-		Remaining:  int(values[1].(int64)),
-		RetryAfter: dur(retryAfter),
-		ResetAfter: dur(resetAfter),
+	if cache {
+		l.denials.add(key, needed, res)
 	}
 
 	return res, nil
 }
 
+// Inspect reports the state of the key without consuming. Allowed is always 0,
+// Remaining is the number of events which may happen now and RetryAfter is the
+// time until one event may happen, or -1 if it may happen now.
+func (l Limiter) Inspect(ctx context.Context, key string, limit Limit) (*Result, error) {
+	return l.backend.Inspect(ctx, key, limit)
+}
+
 // Reset gets a key and reset all limitations and previous usages
 func (l *Limiter) Reset(ctx context.Context, key string) error {
-	return l.rdb.Del(ctx, key).Err()
+	if l.denials != nil {
+		l.denials.remove(key)
+	}
+
+	return l.backend.Reset(ctx, key)
 }
 
 func dur(f float64) time.Duration {
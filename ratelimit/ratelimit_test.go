@@ -0,0 +1,183 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/clubpay/qlubkit-go/ratelimit"
+	"github.com/redis/go-redis/v9"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// backends returns all the backends, every test runs against all of them to make
+// sure they return identical results.
+func backends(t *testing.T) map[string]ratelimit.Backend {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	crdb := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{miniredis.RunT(t).Addr()}})
+	t.Cleanup(func() { _ = crdb.Close() })
+
+	return map[string]ratelimit.Backend{
+		"Memory":       ratelimit.NewMemoryBackend(),
+		"Redis":        ratelimit.NewRedisBackend(rdb),
+		"RedisCluster": ratelimit.NewRedisBackend(crdb),
+	}
+}
+
+type step struct {
+	atMost bool
+	reset  bool
+	n      int
+	res    ratelimit.Result
+}
+
+// tolerance covers the time passed between the steps.
+const tolerance = 0.05
+
+func runSteps(c C, l *ratelimit.Limiter, key string, limit ratelimit.Limit, steps []step) {
+	ctx := context.Background()
+	for _, s := range steps {
+		if s.reset {
+			c.So(l.Reset(ctx, key), ShouldBeNil)
+
+			continue
+		}
+
+		var (
+			res *ratelimit.Result
+			err error
+		)
+		if s.atMost {
+			res, err = l.AllowAtMost(ctx, key, limit, s.n)
+		} else {
+			res, err = l.AllowN(ctx, key, limit, s.n)
+		}
+		c.So(err, ShouldBeNil)
+		c.So(res.Limit, ShouldEqual, limit)
+		c.So(res.Allowed, ShouldEqual, s.res.Allowed)
+		c.So(res.Remaining, ShouldEqual, s.res.Remaining)
+		c.So(res.RetryAfter.Seconds(), ShouldAlmostEqual, s.res.RetryAfter.Seconds(), tolerance)
+		c.So(res.ResetAfter.Seconds(), ShouldAlmostEqual, s.res.ResetAfter.Seconds(), tolerance)
+	}
+}
+
+func TestBackendConformance(t *testing.T) {
+	cases := []struct {
+		name  string
+		limit ratelimit.Limit
+		steps []step
+	}{
+		{
+			name:  "Allow",
+			limit: ratelimit.PerSecond(8),
+			steps: []step{
+				{n: 1, res: ratelimit.Result{Allowed: 1, Remaining: 7, RetryAfter: -1, ResetAfter: 125 * time.Millisecond}},
+				{n: 1, res: ratelimit.Result{Allowed: 1, Remaining: 6, RetryAfter: -1, ResetAfter: 250 * time.Millisecond}},
+			},
+		},
+		{
+			name:  "Burst exhausted",
+			limit: ratelimit.PerMinute(10),
+			steps: []step{
+				{n: 10, res: ratelimit.Result{Allowed: 10, Remaining: 0, RetryAfter: -1, ResetAfter: time.Minute}},
+				{n: 1, res: ratelimit.Result{Allowed: 0, Remaining: 0, RetryAfter: 6 * time.Second, ResetAfter: time.Minute}},
+				{n: 1, atMost: true, res: ratelimit.Result{Allowed: 0, Remaining: 0, RetryAfter: 6 * time.Second, ResetAfter: time.Minute}},
+			},
+		},
+		{
+			name:  "AllowN is all or nothing",
+			limit: ratelimit.PerMinute(10),
+			steps: []step{
+				{n: 7, res: ratelimit.Result{Allowed: 7, Remaining: 3, RetryAfter: -1, ResetAfter: 42 * time.Second}},
+				{n: 5, res: ratelimit.Result{Allowed: 0, Remaining: 0, RetryAfter: 12 * time.Second, ResetAfter: 42 * time.Second}},
+				{n: 3, res: ratelimit.Result{Allowed: 3, Remaining: 0, RetryAfter: -1, ResetAfter: time.Minute}},
+			},
+		},
+		{
+			name:  "AllowAtMost allows the remaining",
+			limit: ratelimit.PerMinute(10),
+			steps: []step{
+				{n: 7, res: ratelimit.Result{Allowed: 7, Remaining: 3, RetryAfter: -1, ResetAfter: 42 * time.Second}},
+				{n: 5, atMost: true, res: ratelimit.Result{Allowed: 3, Remaining: 0, RetryAfter: -1, ResetAfter: time.Minute}},
+			},
+		},
+		{
+			name:  "Reset",
+			limit: ratelimit.PerMinute(10),
+			steps: []step{
+				{n: 10, res: ratelimit.Result{Allowed: 10, Remaining: 0, RetryAfter: -1, ResetAfter: time.Minute}},
+				{reset: true},
+				{n: 1, res: ratelimit.Result{Allowed: 1, Remaining: 9, RetryAfter: -1, ResetAfter: 6 * time.Second}},
+			},
+		},
+		{
+			name:  "Burst larger than rate",
+			limit: ratelimit.Limit{Rate: 1, Period: time.Second, Burst: 5},
+			steps: []step{
+				{n: 5, res: ratelimit.Result{Allowed: 5, Remaining: 0, RetryAfter: -1, ResetAfter: 5 * time.Second}},
+				{n: 1, res: ratelimit.Result{Allowed: 0, Remaining: 0, RetryAfter: time.Second, ResetAfter: 5 * time.Second}},
+			},
+		},
+	}
+
+	Convey("Backend conformance", t, func(c C) {
+		for name, b := range backends(t) {
+			l := ratelimit.NewLimiterWithBackend(b)
+			for _, tc := range cases {
+				Convey(name+"/"+tc.name, func(c C) {
+					runSteps(c, l, tc.name, tc.limit, tc.steps)
+				})
+			}
+		}
+	})
+}
+
+func TestLimiterKeys(t *testing.T) {
+	Convey("Keys are independent", t, func(c C) {
+		ctx := context.Background()
+		for name, b := range backends(t) {
+			Convey(name, func(c C) {
+				l := ratelimit.NewLimiterWithBackend(b)
+				res, err := l.AllowN(ctx, "k1", ratelimit.PerHour(2), 2)
+				c.So(err, ShouldBeNil)
+				c.So(res.Allowed, ShouldEqual, 2)
+
+				res, err = l.Allow(ctx, "k1", ratelimit.PerHour(2))
+				c.So(err, ShouldBeNil)
+				c.So(res.Allowed, ShouldEqual, 0)
+
+				res, err = l.Allow(ctx, "k2", ratelimit.PerHour(2))
+				c.So(err, ShouldBeNil)
+				c.So(res.Allowed, ShouldEqual, 1)
+			})
+		}
+	})
+}
+
+func TestSlotKey(t *testing.T) {
+	Convey("Derived keys share the slot of the key", t, func(c C) {
+		c.So(ratelimit.HashTag("user:1"), ShouldEqual, "user:1")
+		c.So(ratelimit.HashTag("user:{1}:x"), ShouldEqual, "1")
+		c.So(ratelimit.HashTag("user:{}:x"), ShouldEqual, "user:{}:x")
+		c.So(ratelimit.HashTag("user:{1"), ShouldEqual, "user:{1")
+
+		c.So(ratelimit.SlotKey("user:1", "s"), ShouldEqual, "{user:1}:s")
+		c.So(ratelimit.SlotKey("user:{1}", "s"), ShouldEqual, "user:{1}:s")
+		c.So(ratelimit.HashTag(ratelimit.SlotKey("user:1", "s")), ShouldEqual, "user:1")
+
+		Convey("Keys with unbalanced braces are tagged by their hash", func(c C) {
+			for _, key := range []string{"user:}1", "user:{1", "user:{}:1", "}{"} {
+				k1 := ratelimit.SlotKey(key, "a")
+				k2 := ratelimit.SlotKey(key, "b")
+				c.So(ratelimit.HashTag(k1), ShouldEqual, ratelimit.HashTag(k2))
+				c.So(ratelimit.HashTag(k1), ShouldNotContainSubstring, "}")
+				c.So(k1, ShouldNotEqual, ratelimit.SlotKey(key+"x", "a"))
+			}
+			c.So(ratelimit.HashTag(ratelimit.SlotKey("a}", "s")), ShouldNotEqual, ratelimit.HashTag(ratelimit.SlotKey("b}", "s")))
+		})
+	})
+}
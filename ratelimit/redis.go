@@ -0,0 +1,201 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type redisBackend struct {
+	rdb redis.UniversalClient
+}
+
+var _ Backend = (*redisBackend)(nil)
+
+// NewRedisBackend returns a Backend which runs the GCRA algorithm in Redis by Lua
+// scripts, hence the limits are shared by all the instances using the same Redis.
+// rdb can be a single node, cluster or sentinel client.
+func NewRedisBackend(rdb redis.UniversalClient) Backend {
+	return &redisBackend{
+		rdb: rdb,
+	}
+}
+
+func (b *redisBackend) AllowN(ctx context.Context, key string, limit Limit, n int) (*Result, error) {
+	if limit.Algorithm != GCRA {
+		return b.runWindow(ctx, key, limit, n, windowAllowN)
+	}
+
+	values := []any{limit.Burst, limit.Rate, limit.Period.Seconds(), n}
+
+	return b.run(ctx, luaAllowN, key, limit, values)
+}
+
+func (b *redisBackend) AllowAtMost(ctx context.Context, key string, limit Limit, n int) (*Result, error) {
+	if limit.Algorithm != GCRA {
+		return b.runWindow(ctx, key, limit, n, windowAllowAtMost)
+	}
+
+	values := []any{limit.Burst, limit.Rate, limit.Period.Seconds(), n}
+
+	return b.run(ctx, luaAllowAtMost, key, limit, values)
+}
+
+func (b *redisBackend) Reserve(
+	ctx context.Context,
+	key string,
+	limit Limit,
+	n int,
+	maxWait time.Duration,
+) (*Result, error) {
+	maxWaitSeconds := -1.0
+	if maxWait >= 0 {
+		maxWaitSeconds = maxWait.Seconds()
+	}
+	values := []any{limit.Burst, limit.Rate, limit.Period.Seconds(), n, maxWaitSeconds}
+
+	return b.run(ctx, luaReserveN, key, limit, values)
+}
+
+func (b *redisBackend) Cancel(ctx context.Context, key string, limit Limit, n int) error {
+	values := []any{limit.Rate, limit.Period.Seconds(), n}
+
+	return luaCancelN.Run(ctx, b.rdb, []string{key}, values...).Err()
+}
+
+func (b *redisBackend) AllowMulti(
+	ctx context.Context,
+	key string,
+	limits []Limit,
+	n int,
+) (*MultiResult, error) {
+	keys := make([]string, len(limits))
+	values := make([]any, 0, 1+3*len(limits))
+	values = append(values, n)
+	for i, limit := range limits {
+		keys[i] = windowKey(key, limit)
+		values = append(values, limit.Burst, limit.Rate, limit.Period.Seconds())
+	}
+
+	v, err := luaAllowMulti.Run(ctx, b.rdb, keys, values...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values, _ = v.([]any)
+
+	//nolint:forcetypeassert
+	res := &MultiResult{
+		Allowed: int(values[0].(int64)),
+		Binding: int(values[1].(int64)) - 1,
+		Results: make([]Result, len(limits)),
+	}
+	for i, limit := range limits {
+		w := values[2+3*i:]
+
+		retryAfter, err := strconv.ParseFloat(w[1].(string), 64)
+		if err != nil {
+			return nil, err
+		}
+
+		resetAfter, err := strconv.ParseFloat(w[2].(string), 64)
+		if err != nil {
+			return nil, err
+		}
+
+		//nolint:forcetypeassert
+		res.Results[i] = Result{
+			Limit:      limit,
+			Allowed:    res.Allowed,
+			Remaining:  int(w[0].(int64)),
+			RetryAfter: dur(retryAfter),
+			ResetAfter: dur(resetAfter),
+		}
+	}
+
+	return res, nil
+}
+
+func (b *redisBackend) Inspect(ctx context.Context, key string, limit Limit) (*Result, error) {
+	if limit.Algorithm != GCRA {
+		return b.runWindow(ctx, key, limit, 0, windowInspect)
+	}
+
+	values := []any{limit.Burst, limit.Rate, limit.Period.Seconds()}
+
+	return b.run(ctx, luaInspect, key, limit, values)
+}
+
+func (b *redisBackend) Reset(ctx context.Context, key string) error {
+	return b.rdb.Del(ctx, key).Err()
+}
+
+// runWindow runs the script of the window algorithms.
+func (b *redisBackend) runWindow(
+	ctx context.Context,
+	key string,
+	limit Limit,
+	n int,
+	mode windowMode,
+) (*Result, error) {
+	var script *redis.Script
+	switch limit.Algorithm {
+	case FixedWindow:
+		script = luaFixedWindow
+	case SlidingWindowLog:
+		script = luaSlidingLog
+	case SlidingWindowCounter:
+		script = luaSlidingCounter
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	atMost, inspect := 0, 0
+	switch mode {
+	case windowAllowAtMost:
+		atMost = 1
+	case windowInspect:
+		inspect = 1
+	}
+	values := []any{limit.Rate, limit.Period.Milliseconds(), n, atMost, inspect}
+
+	return b.run(ctx, script, key, limit, values)
+}
+
+func (b *redisBackend) run(
+	ctx context.Context,
+	script *redis.Script,
+	key string,
+	limit Limit,
+	values []any,
+) (*Result, error) {
+	v, err := script.Run(ctx, b.rdb, []string{key}, values...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values, _ = v.([]any)
+
+	retryAfter, err := strconv.ParseFloat(values[2].(string), 64)
+	if err != nil {
+		return nil, err
+	}
+
+	resetAfter, err := strconv.ParseFloat(values[3].(string), 64)
+	if err != nil {
+		return nil, err
+	}
+
+	//nolint:forcetypeassert
+	res := &Result{
+		Limit:      limit,
+		Allowed:    int(values[0].(int64)),
+		Remaining:  int(values[1].(int64)),
+		RetryAfter: dur(retryAfter),
+		ResetAfter: dur(resetAfter),
+	}
+
+	return res, nil
+}
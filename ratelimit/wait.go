@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrExceedsBurst        = errors.New("ratelimit: n exceeds the burst of the limit")
+	ErrWaitExceedsDeadline = errors.New("ratelimit: wait would exceed the context deadline")
+)
+
+// Reservation holds the events booked by Limiter.Reserve.
+type Reservation struct {
+	mtx       sync.Mutex
+	backend   Backend
+	key       string
+	limit     Limit
+	n         int
+	res       *Result
+	readyAt   time.Time
+	cancelled bool
+}
+
+// OK reports whether the events have been booked.
+func (r *Reservation) OK() bool {
+	return r.res.Allowed > 0
+}
+
+// Result returns the result of the reservation.
+func (r *Reservation) Result() *Result {
+	return r.res
+}
+
+// Delay returns the time to wait before the booked events can happen.
+func (r *Reservation) Delay() time.Duration {
+	return max(time.Until(r.readyAt), 0)
+}
+
+// Cancel returns the booked events to the limiter, so others can use them. It does
+// nothing if the booked events could already happen.
+func (r *Reservation) Cancel(ctx context.Context) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if !r.OK() || r.cancelled || !time.Now().Before(r.readyAt) {
+		return nil
+	}
+	r.cancelled = true
+
+	return r.backend.Cancel(ctx, r.key, r.limit, r.n)
+}
+
+// Reserve books n events which can happen after Reservation.Delay. The caller must
+// either wait for the delay or cancel the reservation. Only GCRA limits are supported.
+func (l Limiter) Reserve(ctx context.Context, key string, limit Limit, n int) (*Reservation, error) {
+	if limit.Algorithm != GCRA {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	if n > limit.Burst {
+		return nil, ErrExceedsBurst
+	}
+
+	return l.reserve(ctx, key, limit, n, -1)
+}
+
+// Wait is a shortcut for WaitN(ctx, key, limit, 1).
+func (l Limiter) Wait(ctx context.Context, key string, limit Limit) error {
+	return l.WaitN(ctx, key, limit, 1)
+}
+
+// WaitN blocks until n events are allowed. It returns an error immediately if the
+// events would not be allowed before the deadline of ctx. If ctx is done while
+// waiting, the booked events are returned to the limiter. Only GCRA limits are
+// supported.
+func (l Limiter) WaitN(ctx context.Context, key string, limit Limit, n int) error {
+	if limit.Algorithm != GCRA {
+		return ErrUnsupportedAlgorithm
+	}
+	if n > limit.Burst {
+		return ErrExceedsBurst
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	maxWait := time.Duration(-1)
+	if deadline, ok := ctx.Deadline(); ok {
+		maxWait = max(time.Until(deadline), 0)
+	}
+
+	r, err := l.reserve(ctx, key, limit, n, maxWait)
+	if err != nil {
+		return err
+	}
+	if !r.OK() {
+		return ErrWaitExceedsDeadline
+	}
+
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		_ = r.Cancel(context.WithoutCancel(ctx))
+
+		return ctx.Err()
+	}
+}
+
+func (l Limiter) reserve(
+	ctx context.Context,
+	key string,
+	limit Limit,
+	n int,
+	maxWait time.Duration,
+) (*Reservation, error) {
+	now := time.Now()
+	res, err := l.backend.Reserve(ctx, key, limit, n, maxWait)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reservation{
+		backend: l.backend,
+		key:     key,
+		limit:   limit,
+		n:       n,
+		res:     res,
+		readyAt: now,
+	}
+	if res.RetryAfter > 0 {
+		r.readyAt = now.Add(res.RetryAfter)
+	}
+
+	return r, nil
+}
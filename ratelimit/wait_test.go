@@ -0,0 +1,90 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/clubpay/qlubkit-go/ratelimit"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReserve(t *testing.T) {
+	Convey("Reserve", t, func(c C) {
+		ctx := context.Background()
+		limit := ratelimit.PerMinute(10)
+		for name, b := range backends(t) {
+			Convey(name, func(c C) {
+				l := ratelimit.NewLimiterWithBackend(b)
+
+				r, err := l.Reserve(ctx, "k", limit, 10)
+				c.So(err, ShouldBeNil)
+				c.So(r.OK(), ShouldBeTrue)
+				c.So(r.Delay(), ShouldEqual, 0)
+
+				r, err = l.Reserve(ctx, "k", limit, 2)
+				c.So(err, ShouldBeNil)
+				c.So(r.OK(), ShouldBeTrue)
+				c.So(r.Delay().Seconds(), ShouldAlmostEqual, 12, tolerance)
+
+				// Future capacity is booked.
+				res, err := l.Allow(ctx, "k", limit)
+				c.So(err, ShouldBeNil)
+				c.So(res.Allowed, ShouldEqual, 0)
+				c.So(res.RetryAfter.Seconds(), ShouldAlmostEqual, 18, tolerance)
+
+				c.So(r.Cancel(ctx), ShouldBeNil)
+				res, err = l.Allow(ctx, "k", limit)
+				c.So(err, ShouldBeNil)
+				c.So(res.Allowed, ShouldEqual, 0)
+				c.So(res.RetryAfter.Seconds(), ShouldAlmostEqual, 6, tolerance)
+
+				_, err = l.Reserve(ctx, "k", limit, 11)
+				c.So(err, ShouldEqual, ratelimit.ErrExceedsBurst)
+			})
+		}
+	})
+}
+
+func TestWait(t *testing.T) {
+	Convey("Wait", t, func(c C) {
+		limit := ratelimit.Limit{Rate: 10, Period: time.Second, Burst: 1}
+		for name, b := range backends(t) {
+			Convey(name, func(c C) {
+				ctx := context.Background()
+				l := ratelimit.NewLimiterWithBackend(b)
+
+				start := time.Now()
+				for i := 0; i < 3; i++ {
+					c.So(l.Wait(ctx, "k", limit), ShouldBeNil)
+				}
+				c.So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 190*time.Millisecond)
+
+				// The deadline is too close.
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				defer cancel()
+				c.So(l.Wait(ctx, "k", limit), ShouldEqual, ratelimit.ErrWaitExceedsDeadline)
+
+				c.So(l.WaitN(context.Background(), "k", limit, 2), ShouldEqual, ratelimit.ErrExceedsBurst)
+			})
+		}
+	})
+
+	Convey("Wait returns the events if the context is cancelled", t, func(c C) {
+		limit := ratelimit.Limit{Rate: 1, Period: time.Minute, Burst: 1}
+		l := ratelimit.NewLimiterWithBackend(ratelimit.NewMemoryBackend())
+		c.So(l.Wait(context.Background(), "k", limit), ShouldBeNil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			cancel()
+		}()
+		c.So(l.Wait(ctx, "k", limit), ShouldEqual, context.Canceled)
+
+		res, err := l.Allow(context.Background(), "k", limit)
+		c.So(err, ShouldBeNil)
+		c.So(res.RetryAfter.Seconds(), ShouldAlmostEqual, 60, tolerance)
+	})
+}
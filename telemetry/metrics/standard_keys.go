@@ -1,10 +1,15 @@
 package qmetrics
 
 const (
-	QlubHttpRequestCnt       = "http.requests"
-	QlubHttpResponseTimeHist = "http.response.time"
-	QlubPaymentSuccess       = "qlub.payment.success"
-	QlubPaymentAmountBill    = "qlub.payment.amount.bill"
-	QlubPaymentAmountTip     = "qlub.payment.amount.tip"
-	QlubPaymentCommission    = "qlub.payment.commission"
+	QlubHttpRequestCnt        = "http.requests"
+	QlubHttpResponseTimeHist  = "http.response.time"
+	QlubPaymentSuccess        = "qlub.payment.success"
+	QlubPaymentAmountBill     = "qlub.payment.amount.bill"
+	QlubPaymentAmountTip      = "qlub.payment.amount.tip"
+	QlubPaymentCommission     = "qlub.payment.commission"
+	QlubRateLimitAllowedCnt   = "ratelimit.allowed"
+	QlubRateLimitDeniedCnt    = "ratelimit.denied"
+	QlubRateLimitLatencyHist  = "ratelimit.latency"
+	QlubKafkaDeliveredCnt     = "kafka.producer.delivered"
+	QlubKafkaDeliveryErrorCnt = "kafka.producer.delivery.errors"
 )
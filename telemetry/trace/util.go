@@ -17,8 +17,10 @@ func Span(ctx context.Context, attrs ...attribute.KeyValue) trace.Span {
 	return span
 }
 
-func NewSpan(instrument, spanName string, ctx context.Context) (context.Context, trace.Span) {
-	ctx, span := otel.Tracer(instrument).Start(ctx, spanName)
+func NewSpan(
+	instrument, spanName string, ctx context.Context, opts ...trace.SpanStartOption,
+) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer(instrument).Start(ctx, spanName, opts...)
 
 	return ctx, span
 }